@@ -5,12 +5,20 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"mangahub/internal/auth"
+	"mangahub/pkg/database"
 )
 
 const API = "http://localhost:8080"
@@ -54,8 +62,9 @@ func login() {
 	password := input("Password: ")
 
 	body, _ := json.Marshal(map[string]string{
-		"username": username,
-		"password": password,
+		"username":    username,
+		"password":    password,
+		"device_name": "MangaHub admin CLI",
 	})
 
 	resp, err := http.Post(API+"/auth/login", "application/json", bytes.NewReader(body))
@@ -64,11 +73,15 @@ func login() {
 	}
 	defer resp.Body.Close()
 
-	var res map[string]string
+	var res map[string]any
 	json.NewDecoder(resp.Body).Decode(&res)
 
-	accessToken = res["access_token"]
-	refreshToken = res["refresh_token"]
+	if res["two_factor_required"] == true {
+		res = secondFactor(res)
+	}
+
+	accessToken, _ = res["access_token"].(string)
+	refreshToken, _ = res["refresh_token"].(string)
 
 	if accessToken == "" {
 		fmt.Println("Login failed")
@@ -83,6 +96,57 @@ func login() {
 
 	fmt.Println("Admin login successful")
 }
+
+// secondFactor finishes a login that needs a TOTP code, enrolling first
+// when admins are required to use 2FA and this one has not set it up.
+func secondFactor(res map[string]any) map[string]any {
+	challenge, _ := res["challenge_token"].(string)
+
+	if res["enroll"] == true {
+		fmt.Println("Admins must use two-factor authentication.")
+		enroll := postJSON("/auth/2fa/enroll", map[string]string{"challenge_token": challenge})
+		if enroll["otpauth_uri"] == nil {
+			fmt.Println("Enrollment failed:", enroll["error"])
+			os.Exit(1)
+		}
+		fmt.Println("Add this to your authenticator app:", enroll["otpauth_uri"])
+		fmt.Println("or enter the key by hand:", enroll["secret"])
+	}
+
+	for {
+		out := postJSON("/auth/2fa/verify", map[string]string{
+			"challenge_token": challenge,
+			"code":            input("Authentication code (or recovery code): "),
+		})
+		if out["access_token"] != nil {
+			if codes, ok := out["recovery_codes"].([]any); ok {
+				fmt.Println("Recovery codes (each works once, keep them safe):")
+				for _, c := range codes {
+					fmt.Println("  ", c)
+				}
+			}
+			return out
+		}
+		if out["error"] != "invalid code" {
+			return out
+		}
+		fmt.Println("Invalid code, try again")
+	}
+}
+
+func postJSON(path string, payload any) map[string]any {
+	body, _ := json.Marshal(payload)
+	resp, err := http.Post(API+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+
+	var res map[string]any
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res
+}
+
 func refreshAccessToken() error {
 	body, _ := json.Marshal(map[string]string{
 		"refresh_token": refreshToken,
@@ -107,6 +171,10 @@ func refreshAccessToken() error {
 	}
 
 	accessToken = newToken
+	// refresh tokens are single use, keep the one we were handed
+	if res["refresh_token"] != "" {
+		refreshToken = res["refresh_token"]
+	}
 	return nil
 }
 func doAuthRequest(req *http.Request) (*http.Response, error) {
@@ -128,7 +196,10 @@ func doAuthRequest(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	// retry with new token
+	// retry with new token; the first attempt consumed the body
+	if req.GetBody != nil {
+		req.Body, _ = req.GetBody()
+	}
 	authHeader(req)
 	return http.DefaultClient.Do(req)
 }
@@ -139,37 +210,383 @@ func addManga() {
 		"title":          input("Title: "),
 		"author":         input("Author: "),
 		"genres":         strings.Split(input("Genres (comma): "), ","),
-		"status":         input("Status: "),
+		"status":         input("Status (RELEASING, FINISHED, CANCELLED, HIATUS, NOT_YET_RELEASED): "),
 		"total_chapters": mustInt(input("Total chapters: ")),
 		"description":    input("Description: "),
 	}
 
-	data, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", API+"/admin/manga", bytes.NewBuffer(data))
+	if adminJSON("POST", "/admin/manga", payload, nil) {
+		fmt.Println("Manga added")
+	}
+}
 
-	resp, err := doAuthRequest(req)
-	if err != nil {
-		fmt.Println("Request failed:", err)
+func deleteManga() {
+	id := input("Manga ID to delete: ")
+
+	if adminJSON("DELETE", "/admin/manga/"+url.PathEscape(id), nil, nil) {
+		fmt.Println("Manga deleted")
+	}
+}
+
+type revision struct {
+	ID        int64  `json:"id"`
+	Version   int    `json:"version"`
+	Action    string `json:"action"`
+	Editor    string `json:"editor"`
+	EditorID  string `json:"editor_id"`
+	RevertOf  int64  `json:"revert_of"`
+	CreatedAt string `json:"created_at"`
+	Changes   map[string]struct {
+		From json.RawMessage `json:"from"`
+		To   json.RawMessage `json:"to"`
+	} `json:"changes"`
+}
+
+// mangaHistory shows the revisions of a manga field by field and can
+// put an older revision back.
+func mangaHistory() {
+	id := url.PathEscape(input("Manga ID: "))
+
+	var res struct {
+		Version   int        `json:"version"`
+		Revisions []revision `json:"revisions"`
+	}
+	if !adminJSON("GET", "/admin/manga/"+id+"/revisions?limit=20", nil, &res) {
 		return
 	}
-	defer resp.Body.Close()
+	if len(res.Revisions) == 0 {
+		fmt.Println("No revisions yet")
+		return
+	}
+
+	for _, r := range res.Revisions {
+		editor := r.Editor
+		if editor == "" {
+			editor = r.EditorID
+		}
+		if editor == "" {
+			editor = "-"
+		}
+		fmt.Printf("\n#%d  v%d  %s  %-16s by %s\n", r.ID, r.Version, r.CreatedAt[:19], r.Action, editor)
+		if r.RevertOf != 0 {
+			fmt.Printf("    (back to #%d)\n", r.RevertOf)
+		}
 
-	fmt.Println("Add manga status:", resp.Status)
+		fields := make([]string, 0, len(r.Changes))
+		for f := range r.Changes {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			ch := r.Changes[f]
+			fmt.Printf("    %-15s - %s\n", f, shorten(string(ch.From)))
+			fmt.Printf("    %-15s + %s\n", "", shorten(string(ch.To)))
+		}
+	}
+
+	if res.Version == 0 {
+		fmt.Println("\nThe manga is in the trash; restore it before reverting")
+		return
+	}
+	rev := input("\nRevert to revision # (empty = no): ")
+	if rev == "" {
+		return
+	}
+	req, _ := http.NewRequest("POST", API+"/admin/manga/"+id+"/revisions/"+url.PathEscape(rev)+"/revert", nil)
+	req.Header.Set("If-Match", fmt.Sprintf("%q", strconv.Itoa(res.Version)))
+	var m struct {
+		Version int `json:"version"`
+	}
+	if adminDo(req, &m) {
+		fmt.Printf("Reverted, manga is now at version %d\n", m.Version)
+	}
 }
 
-func deleteManga() {
-	id := input("Manga ID to delete: ")
+// shorten keeps long descriptions to one readable line.
+func shorten(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 70 {
+		return string(r[:67]) + "..."
+	}
+	return s
+}
+
+// ---------------------------
+// USER MANAGEMENT
+// ---------------------------
+
+type account struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`
+	Sessions    int    `json:"sessions"`
+	LibrarySize int    `json:"library_size"`
+	Suspension  *struct {
+		Reason string  `json:"reason"`
+		Until  *string `json:"until"`
+	} `json:"suspension"`
+}
 
-	req, _ := http.NewRequest("DELETE", API+"/admin/manga/"+id, nil)
+// adminJSON sends an admin request and decodes the reply into out,
+// printing the server's error message when there is one.
+func adminJSON(method, path string, payload any, out any) bool {
+	var body *bytes.Buffer
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(data)
+	} else {
+		body = &bytes.Buffer{}
+	}
+
+	req, _ := http.NewRequest(method, API+path, body)
+	return adminDo(req, out)
+}
 
+// adminDo is adminJSON for a request that needs its own headers.
+func adminDo(req *http.Request, out any) bool {
 	resp, err := doAuthRequest(req)
 	if err != nil {
 		fmt.Println("Request failed:", err)
-		return
+		return false
 	}
 	defer resp.Body.Close()
 
-	fmt.Println("Delete status:", resp.Status)
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		fmt.Println("Error:", resp.Status, e.Error)
+		return false
+	}
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return true
+}
+
+func printAccounts(list []account, total int) {
+	fmt.Printf("%-6s %-20s %-8s %-9s %-8s %s\n", "ID", "USERNAME", "ROLE", "SESSIONS", "LIBRARY", "STATUS")
+	for _, a := range list {
+		state := "active"
+		if a.Suspension != nil {
+			state = "suspended: " + a.Suspension.Reason
+			if a.Suspension.Until != nil {
+				state += " (until " + *a.Suspension.Until + ")"
+			}
+		}
+		fmt.Printf("%-6s %-20s %-8s %-9d %-8d %s\n", a.ID, a.Username, a.Role, a.Sessions, a.LibrarySize, state)
+	}
+	fmt.Printf("%d of %d users\n", len(list), total)
+}
+
+func listUsers(query string) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("q", query)
+	}
+	if role := input("Role filter (empty = all): "); role != "" {
+		params.Set("role", role)
+	}
+	if strings.EqualFold(input("Only suspended? (y/N): "), "y") {
+		params.Set("suspended", "1")
+	}
+
+	var res struct {
+		Users []account `json:"users"`
+		Total int       `json:"total"`
+	}
+	if adminJSON("GET", "/admin/users?"+params.Encode(), nil, &res) {
+		printAccounts(res.Users, res.Total)
+	}
+}
+
+func changeRole() {
+	id := input("User ID: ")
+	role := input("New role (user/moderator/editor/uploader/admin): ")
+
+	if adminJSON("PUT", "/admin/users/"+id+"/role", map[string]string{"role": role}, nil) {
+		fmt.Println("Role updated")
+	}
+}
+
+func suspendUser() {
+	id := input("User ID: ")
+	reason := input("Reason: ")
+	days := mustInt(input("Days (0 = until lifted): "))
+
+	payload := map[string]any{"reason": reason}
+	if days > 0 {
+		payload["days"] = days
+	}
+	if adminJSON("POST", "/admin/users/"+id+"/suspend", payload, nil) {
+		fmt.Println("User suspended and logged out")
+	}
+}
+
+func unsuspendUser() {
+	id := input("User ID: ")
+	if adminJSON("DELETE", "/admin/users/"+id+"/suspend", nil, nil) {
+		fmt.Println("Suspension lifted")
+	}
+}
+
+func requireAdmin2FA() {
+	var res struct {
+		Roles []string `json:"required_roles"`
+	}
+	if !adminJSON("GET", "/admin/security/2fa", nil, &res) {
+		return
+	}
+	required := false
+	for _, r := range res.Roles {
+		if r == "admin" {
+			required = true
+		}
+	}
+	fmt.Println("2FA required for admins:", required)
+
+	answer := strings.ToLower(input("Require it? (y/n, empty = keep): "))
+	if answer != "y" && answer != "n" {
+		return
+	}
+	payload := map[string]any{"role": "admin", "required": answer == "y"}
+	if adminJSON("PUT", "/admin/security/2fa", payload, nil) {
+		fmt.Println("Saved, applies from each admin's next login")
+	}
+}
+
+func revokeSessions() {
+	id := input("User ID: ")
+
+	var res struct {
+		Revoked int `json:"revoked"`
+	}
+	if adminJSON("DELETE", "/admin/users/"+id+"/sessions", nil, &res) {
+		fmt.Printf("Revoked %d session(s)\n", res.Revoked)
+	}
+}
+
+type auditEvent struct {
+	ID         int64           `json:"id"`
+	CreatedAt  string          `json:"created_at"`
+	ActorName  string          `json:"actor_name"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IP         string          `json:"ip"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+// auditLog shows recent audit events, or saves every match as JSONL.
+func auditLog() {
+	params := url.Values{}
+	if v := input("Action (e.g. manga.delete, or auth. for a prefix; empty = all): "); v != "" {
+		params.Set("action", v)
+	}
+	if v := input("Actor id or username (empty = all): "); v != "" {
+		params.Set("actor", v)
+	}
+	if v := input("Target id (empty = all): "); v != "" {
+		params.Set("target_id", v)
+	}
+
+	if file := input("Export to file (empty = show last 20): "); file != "" {
+		params.Set("format", "jsonl")
+		req, _ := http.NewRequest("GET", API+"/admin/audit?"+params.Encode(), nil)
+		resp, err := doAuthRequest(req)
+		if err != nil {
+			fmt.Println("Request failed:", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error:", resp.Status)
+			return
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer f.Close()
+		n, _ := io.Copy(f, resp.Body)
+		fmt.Printf("Saved %d bytes to %s\n", n, file)
+		return
+	}
+
+	params.Set("limit", "20")
+	var res struct {
+		Events []auditEvent `json:"events"`
+	}
+	if !adminJSON("GET", "/admin/audit?"+params.Encode(), nil, &res) {
+		return
+	}
+	for _, e := range res.Events {
+		actor := e.ActorName
+		if actor == "" {
+			actor = e.ActorID
+		}
+		if actor == "" {
+			actor = "-"
+		}
+		fmt.Printf("%s  %-22s %-12s %s:%s  (%s)\n", e.CreatedAt[:19], e.Action, actor, e.TargetType, e.TargetID, e.IP)
+		if len(e.Before) > 0 {
+			fmt.Println("    before:", string(e.Before))
+		}
+		if len(e.After) > 0 {
+			fmt.Println("    after: ", string(e.After))
+		}
+	}
+	if len(res.Events) == 0 {
+		fmt.Println("No matching events")
+	}
+}
+
+// bootstrap creates the first admin straight in the database, for when
+// there is nobody who could log in to promote anyone:
+//
+//	admin-cli bootstrap -username alice -password secret -db mangahub.db
+//
+// Flags fall back to MANGAHUB_ADMIN_USERNAME, MANGAHUB_ADMIN_PASSWORD
+// and DB_PATH. An existing user is promoted and keeps their password.
+func bootstrap(args []string) {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	username := fs.String("username", os.Getenv("MANGAHUB_ADMIN_USERNAME"), "admin username")
+	password := fs.String("password", os.Getenv("MANGAHUB_ADMIN_PASSWORD"), "password for a new account")
+	dbPath := fs.String("db", os.Getenv("DB_PATH"), "path to mangahub.db")
+	fs.Parse(args)
+
+	if *username == "" {
+		fmt.Println("bootstrap: -username or MANGAHUB_ADMIN_USERNAME is required")
+		os.Exit(2)
+	}
+	if *dbPath == "" {
+		*dbPath = "mangahub.db"
+	}
+
+	db := database.InitDB(*dbPath)
+	defer db.Close()
+
+	created, err := auth.BootstrapAdmin(db, *username, *password)
+	switch {
+	case err == auth.ErrAdminExists:
+		fmt.Println("bootstrap: an admin already exists, use the admin menu instead")
+		os.Exit(1)
+	case err == auth.ErrWeakPassword:
+		fmt.Println("bootstrap: new accounts need a password of at least 6 characters")
+		os.Exit(1)
+	case err != nil:
+		fmt.Println("bootstrap:", err)
+		os.Exit(1)
+	case created:
+		fmt.Println("Created admin", *username)
+	default:
+		fmt.Println("Promoted", *username, "to admin")
+	}
 }
 
 func mustInt(s string) int {
@@ -185,6 +602,10 @@ func startTCPListener() error {
 	}
 	defer conn.Close()
 
+	// identify ourselves so a revoked session also loses this feed
+	hello, _ := json.Marshal(map[string]string{"type": "AUTH", "token": accessToken})
+	conn.Write(append(hello, '\n'))
+
 	go startHeartbeat(conn)
 
 	scanner := bufio.NewScanner(conn)
@@ -199,8 +620,15 @@ func startTCPListener() error {
 			continue
 		}
 
-		if base.Type == "PONG" {
+		switch base.Type {
+		case "PONG", "AUTH_OK":
 			continue
+		case "AUTH_FAILED":
+			fmt.Println("\n[LIVE] Could not authenticate the live feed")
+			continue
+		case "SESSION_REVOKED":
+			fmt.Println("\nThis session was revoked. Please log in again.")
+			os.Exit(1)
 		}
 
 		var update struct {
@@ -248,6 +676,11 @@ func runTCPClient() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		bootstrap(os.Args[2:])
+		return
+	}
+
 	login()
 	go runTCPClient()
 
@@ -255,7 +688,16 @@ func main() {
 		fmt.Println("\nADMIN MENU")
 		fmt.Println("1) Add manga")
 		fmt.Println("2) Delete manga")
-		fmt.Println("3) Exit")
+		fmt.Println("3) List users")
+		fmt.Println("4) Search users")
+		fmt.Println("5) Change user role")
+		fmt.Println("6) Suspend user")
+		fmt.Println("7) Lift suspension")
+		fmt.Println("8) Force logout user")
+		fmt.Println("9) Require 2FA for admins")
+		fmt.Println("10) Audit log")
+		fmt.Println("11) Manga history")
+		fmt.Println("12) Exit")
 
 		switch input("> ") {
 		case "1":
@@ -263,6 +705,24 @@ func main() {
 		case "2":
 			deleteManga()
 		case "3":
+			listUsers("")
+		case "4":
+			listUsers(input("Search: "))
+		case "5":
+			changeRole()
+		case "6":
+			suspendUser()
+		case "7":
+			unsuspendUser()
+		case "8":
+			revokeSessions()
+		case "9":
+			requireAdmin2FA()
+		case "10":
+			auditLog()
+		case "11":
+			mangaHistory()
+		case "12":
 			return
 		}
 	}
@@ -2,10 +2,18 @@ package main
 
 import (
 	"log"
+	"mangahub/internal/audit"
 	"mangahub/internal/auth"
+	"mangahub/internal/collection"
+	"mangahub/internal/comment"
 	grpcserver "mangahub/internal/grpc"
+	"mangahub/internal/mailer"
 	"mangahub/internal/manga"
+	"mangahub/internal/ratelimit"
+	"mangahub/internal/recommend"
+	"mangahub/internal/review"
 	"mangahub/internal/tcp"
+	"mangahub/internal/trending"
 	"mangahub/internal/udp"
 	"mangahub/internal/user"
 	"mangahub/pkg/database"
@@ -16,7 +24,10 @@ import (
 
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
@@ -33,7 +44,39 @@ func main() {
 
 	defer db.Close()
 
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
+
+	// moderator / editor / uploader, unless they exist already
+	if err := auth.EnsureDefaultRoles(db); err != nil {
+		log.Fatal("roles: ", err)
+	}
+
+	// external login providers (OIDC_PROVIDERS, a JSON file)
+	if err := auth.LoadOIDCProviders(); err != nil {
+		log.Fatal("OIDC providers: ", err)
+	}
+
+	// rate limits (RATE_LIMITS policy file, RATE_LIMIT_DB to share the
+	// buckets with the other servers)
+	limits, err := ratelimit.FromEnv()
+	if err != nil {
+		log.Fatal("rate limits: ", err)
+	}
+
 	udpServer := udp.NewNotificationServer(":9091")
+	udpServer.Limits = limits
+
+	// every change to the catalog goes through here and is announced
+	// over UDP
+	catalog := manga.NewCatalog(db, udpServer)
+
+	// deleted manga can be restored for TRASH_RETENTION_DAYS (30)
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		catalog.Retention = time.Duration(days) * 24 * time.Hour
+	}
+	catalog.StartPurge(time.Hour)
 
 	go func() {
 		log.Println("🔔 UDP notification server starting on :9091")
@@ -45,6 +88,16 @@ func main() {
 	log.Println("HTTP API DB path:", dbPath)
 
 	router := gin.Default()
+
+	// client IPs, which the rate limits and view counts key on, come
+	// from the connection unless a listed proxy forwarded the request
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("TRUSTED_PROXIES: ", err)
+	}
 	for _, r := range router.Routes() {
 		log.Println(r.Method, r.Path)
 	}
@@ -52,8 +105,9 @@ func main() {
 	// --- CORS ---
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, X-Export-Skipped")
 
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(204)
@@ -63,10 +117,24 @@ func main() {
 	})
 
 	// --- Rate Limiting ---
-	router.Use(auth.RateLimitMiddleware()) // 100 requests per minute per IP
+	router.Use(auth.RateLimitMiddleware(db, limits)) // per API key, user or IP; see ratelimit.DefaultPolicy
+
+	// --- Recommendations (model rebuilt when the catalog changes) ---
+	recommender := recommend.NewEngine(db)
+	manga.OnCatalogChange(recommender.Invalidate)
+	recommender.Start(5 * time.Minute)
+	recommender.StartSimilarityJob(30 * time.Minute)
+
+	// --- Trending / popular (cached, refreshed in the background) ---
+	rankings := trending.NewRankings(db)
+	rankings.Start(5 * time.Minute)
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterMangaServiceServer(grpcServer, &grpcserver.GRPCMangaServer{DB: db})
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		grpcserver.AuthInterceptor(db),
+		grpcserver.RateLimit(limits),
+		grpcserver.RequirePermission(grpcserver.RPCPermissions),
+	))
+	pb.RegisterMangaServiceServer(grpcServer, &grpcserver.GRPCMangaServer{DB: db, Catalog: catalog, Recommender: recommender})
 
 	go func() {
 		lis, _ := net.Listen("tcp", ":50051")
@@ -87,17 +155,28 @@ func main() {
 		os.Exit(0)
 	}()
 
-	// --- Public Auth (with strict rate limit for security) ---
+	// verification and password reset emails (SMTP_ADDR / MAIL_DIR)
+	mail := mailer.FromEnv()
+
+	// --- Public Auth (the policy limits /auth/* to 10 requests a minute) ---
 	authGroup := router.Group("/auth")
-	authGroup.Use(auth.StrictRateLimitMiddleware()) // 10 requests per minute for auth endpoints
-	authGroup.POST("/register", auth.RegisterHandler(db))
+	authGroup.POST("/register", auth.RegisterHandler(db, mail))
 	authGroup.POST("/login", auth.LoginHandler(db))
 	authGroup.POST("/logout", auth.LogoutHandler(db))
 	authGroup.POST("/refresh", auth.RefreshHandler(db))
+	authGroup.POST("/2fa/enroll", auth.TwoFactorEnrollHandler(db))
+	authGroup.POST("/2fa/verify", auth.TwoFactorVerifyHandler(db))
+	authGroup.GET("/verify-email", auth.VerifyEmailHandler(db))
+	authGroup.POST("/verify-email", auth.VerifyEmailHandler(db))
+	authGroup.POST("/forgot-password", auth.ForgotPasswordHandler(db, mail))
+	authGroup.POST("/reset-password", auth.ResetPasswordHandler(db))
+	authGroup.GET("/oidc/providers", auth.OIDCProvidersHandler())
+	authGroup.GET("/oidc/:provider/login", auth.OIDCLoginHandler(db))
+	authGroup.GET("/oidc/:provider/callback", auth.OIDCCallbackHandler(db))
 
 	// --- Protected Routes ---
 	authRequired := router.Group("/")
-	authRequired.Use(auth.AuthMiddleware())
+	authRequired.Use(auth.AuthMiddleware(db))
 
 	// Protected: update / get progress
 	var progressEmitter *tcp.ProgressEmitter
@@ -112,18 +191,59 @@ func main() {
 		log.Println("⚠ TCP emitter unavailable, continuing without realtime sync")
 	} else {
 		progressEmitter = emitter
+		if token, err := auth.CreateServiceToken("api-server"); err == nil {
+			progressEmitter.Authenticate(token)
+		}
 	}
 
+	// revoked sessions also lose their live TCP / UDP channels
+	auth.OnSessionRevoked(func(userID, sessionID string) {
+		udpServer.DropSession(userID, sessionID)
+		if progressEmitter != nil {
+			progressEmitter.RevokeSession(userID, sessionID)
+		}
+	})
+
 	user.RegisterProgressRoutes(authRequired, db, progressEmitter)
+	user.RegisterLibraryRoutes(authRequired, db)
+	user.RegisterProfileRoutes(authRequired, db)
+	user.RegisterEmailRoutes(authRequired, db, mail)
+	user.RegisterSessionRoutes(authRequired, db)
+	user.RegisterTwoFactorRoutes(authRequired, db)
+	user.RegisterAPIKeyRoutes(authRequired, db)
+	user.RegisterIdentityRoutes(authRequired, db)
+	recommend.RegisterRoutes(authRequired, recommender)
+
+	// Community features need a verified email
+	verified := authRequired.Group("/")
+	verified.Use(auth.RequireVerifiedEmail())
+	comment.RegisterRoutes(verified, db, progressEmitter)
+	collection.RegisterRoutes(verified, db)
+	review.RegisterRoutes(verified, db)
 
 	// ADMIN
 	admin := router.Group("/admin")
-	admin.Use(auth.AuthMiddleware()) // 1️⃣ parse JWT, set claims
-	admin.Use(auth.AdminOnly())      // 2️⃣ check role
-	manga.RegisterAdminRoutes(admin, db, udpServer)
+	admin.Use(auth.AuthMiddleware(db)) // 1️⃣ parse JWT / API key, set claims
+	admin.Use(auth.StaffOnly())        // 2️⃣ any staff role, routes check permissions
+	manga.RegisterAdminRoutes(admin, catalog)
+	review.RegisterAdminRoutes(admin, db)
+	comment.RegisterAdminRoutes(admin, db)
+	user.RegisterAdminRoutes(admin, db)
+	audit.RegisterAdminRoutes(admin.Group("", auth.AdminOnly()), db)
 
 	// Public manga routes
-	manga.RegisterRoutes(router, db)
+	manga.RegisterRoutes(router, catalog)
+	recommend.RegisterPublicRoutes(router, recommender)
+	trending.RegisterRoutes(router, rankings)
+
+	// Public reading lists, reviews and chapter threads
+	collection.RegisterPublicRoutes(router, db)
+	review.RegisterPublicRoutes(router, db)
+	comment.RegisterPublicRoutes(router, db)
+	user.RegisterPublicProfileRoutes(router, db)
+
+	// public keys for the gRPC / TCP / UDP servers to verify tokens with
+	router.GET("/.well-known/jwks.json", auth.JWKSHandler())
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -8,8 +8,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -73,6 +75,10 @@ func refreshAccessToken() error {
 	}
 
 	accessToken = res["access_token"]
+	// refresh tokens are single use, keep the one we were handed
+	if res["refresh_token"] != "" {
+		refreshToken = res["refresh_token"]
+	}
 	return nil
 }
 
@@ -94,6 +100,11 @@ func doAuthRequest(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	// the first attempt consumed the body
+	if req.GetBody != nil {
+		req.Body, _ = req.GetBody()
+	}
+
 	authHeader(req)
 	return http.DefaultClient.Do(req)
 }
@@ -124,10 +135,13 @@ func registerUser() {
 
 	username := input("Enter username: ")
 	password := input("Enter password: ")
+	email := input("Email (optional, needed for comments, reviews and password reset): ")
 
 	payload := map[string]string{
-		"username": username,
-		"password": password,
+		"username":    username,
+		"password":    password,
+		"email":       email,
+		"device_name": deviceName(),
 	}
 	body, _ := json.Marshal(payload)
 
@@ -150,8 +164,12 @@ func registerUser() {
 				refreshToken = rt
 			}
 			currentUser = getUserIDFromJWT(accessToken)
+			registerUDPSession()
 			fmt.Println("Logged in as:", username)
 		}
+		if reply["email_verification_sent"] == true {
+			verifyEmail()
+		}
 	} else {
 		fmt.Println("Register failed:", reply["error"])
 	}
@@ -187,8 +205,9 @@ func loginUser() {
 	password := input("Password: ")
 
 	payload := map[string]string{
-		"username": username,
-		"password": password,
+		"username":    username,
+		"password":    password,
+		"device_name": deviceName(),
 	}
 	body, _ := json.Marshal(payload)
 
@@ -202,6 +221,10 @@ func loginUser() {
 	var reply map[string]interface{}
 	json.NewDecoder(res.Body).Decode(&reply)
 
+	if reply["two_factor_required"] == true {
+		reply = secondFactor(reply)
+	}
+
 	// support both {"token": "..."} and {"access_token":"..."}
 	if t, ok := reply["access_token"].(string); ok {
 		accessToken = t
@@ -209,6 +232,7 @@ func loginUser() {
 			refreshToken = rt
 		}
 		currentUser = getUserIDFromJWT(accessToken)
+		registerUDPSession()
 
 		fmt.Println("Login successful!")
 	} else if t2, ok := reply["token"].(string); ok {
@@ -220,6 +244,121 @@ func loginUser() {
 	}
 }
 
+// secondFactor finishes a login that needs a TOTP code, enrolling first
+// when the account's role requires 2FA. It returns the token reply.
+func secondFactor(reply map[string]interface{}) map[string]interface{} {
+	challenge, _ := reply["challenge_token"].(string)
+
+	if reply["enroll"] == true {
+		fmt.Println("Your account must use two-factor authentication.")
+		var enroll map[string]interface{}
+		postJSON("/auth/2fa/enroll", map[string]string{"challenge_token": challenge}, &enroll)
+		if enroll["otpauth_uri"] == nil {
+			return enroll
+		}
+		fmt.Println("Add this to your authenticator app:")
+		fmt.Println("  ", enroll["otpauth_uri"])
+		fmt.Println("or enter the key by hand:", enroll["secret"])
+	}
+
+	for {
+		code := input("Authentication code (or recovery code): ")
+		var out map[string]interface{}
+		status := postJSON("/auth/2fa/verify", map[string]string{
+			"challenge_token": challenge,
+			"code":            code,
+		}, &out)
+
+		if status == http.StatusOK {
+			if codes, ok := out["recovery_codes"].([]interface{}); ok {
+				printRecoveryCodes(codes)
+			}
+			return out
+		}
+		if out["error"] != "invalid code" {
+			return out
+		}
+		fmt.Println("Invalid code, try again.")
+	}
+}
+
+func printRecoveryCodes(codes []interface{}) {
+	fmt.Println("\nRecovery codes (each works once, keep them somewhere safe):")
+	for _, c := range codes {
+		fmt.Println("  ", c)
+	}
+	fmt.Println()
+}
+
+func postJSON(path string, payload, out interface{}) int {
+	body, _ := json.Marshal(payload)
+	res, err := http.Post(HTTP_API+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		return 0
+	}
+	defer res.Body.Close()
+	json.NewDecoder(res.Body).Decode(out)
+	return res.StatusCode
+}
+
+// verifyEmail takes the token from the verification email, for people
+// who would rather paste it than open the link.
+func verifyEmail() {
+	fmt.Println("We sent you an email with a verification link.")
+	token := input("Paste the token from the link (Enter to skip): ")
+	if token == "" {
+		return
+	}
+
+	var out map[string]interface{}
+	if postJSON("/auth/verify-email", map[string]string{"token": token}, &out) != http.StatusOK {
+		fmt.Println("Verification failed:", out["error"])
+		return
+	}
+	fmt.Println("Email verified!")
+	// pick up the verified state in a fresh access token
+	if refreshToken != "" {
+		refreshAccessToken()
+	}
+}
+
+func forgotPassword() {
+	clearScreen()
+	printHeader("FORGOT PASSWORD")
+
+	login := input("Username or email: ")
+	var out map[string]interface{}
+	postJSON("/auth/forgot-password", map[string]string{"login": login}, &out)
+	if out["message"] == nil {
+		fmt.Println("Request failed:", out["error"])
+		return
+	}
+	fmt.Println(out["message"])
+
+	token := input("Reset code from the email (Enter to cancel): ")
+	if token == "" {
+		return
+	}
+	password := input("New password: ")
+
+	out = nil
+	if postJSON("/auth/reset-password", map[string]string{"token": token, "password": password}, &out) == http.StatusOK {
+		fmt.Println("Password changed, you can log in now.")
+	} else {
+		fmt.Println("Reset failed:", out["error"])
+	}
+}
+
+// deviceName is how this CLI shows up in the session list.
+func deviceName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "MangaHub CLI"
+	}
+	return "MangaHub CLI on " + host
+}
+
 func logoutUser() {
 	clearScreen()
 	if refreshToken == "" {
@@ -410,19 +549,372 @@ func updateProgressHTTP() {
 	time.Sleep(time.Second)
 }
 
+// ==================================
+// Library import / export
+// ==================================
+func libraryMenu() {
+	for {
+		clearScreen()
+		printHeader("LIBRARY")
+		fmt.Println("Options:")
+		fmt.Println("1) IMPORT (MyAnimeList XML / AniList JSON)")
+		fmt.Println("2) EXPORT (MAL XML / CSV / JSON)")
+		fmt.Println("3) MAIN MENU")
+
+		switch strings.ToLower(input("> ")) {
+		case "1", "import":
+			importLibrary()
+		case "2", "export":
+			exportLibrary()
+		default:
+			return
+		}
+	}
+}
+
+func importLibrary() {
+	clearScreen()
+	printHeader("IMPORT READING LIST")
+
+	path := input("Export file path: ")
+	format := strings.ToLower(input("Format (mal/anilist, empty = detect): "))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Cannot read file:", err)
+		time.Sleep(time.Second)
+		return
+	}
+
+	req, _ := http.NewRequest(
+		"POST",
+		HTTP_API+"/users/library/import?format="+url.QueryEscape(format),
+		bytes.NewReader(data),
+	)
+
+	resp, err := doAuthRequest(req)
+	if err != nil {
+		fmt.Println("Request failed:", err)
+		time.Sleep(time.Second)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var res map[string]string
+		json.NewDecoder(resp.Body).Decode(&res)
+		fmt.Println("Import failed:", res["error"])
+		time.Sleep(time.Second)
+		return
+	}
+
+	var report struct {
+		Total     int `json:"total"`
+		Imported  int `json:"imported"`
+		ByID      int `json:"matched_by_id"`
+		ByTitle   int `json:"matched_by_title"`
+		Unmatched []struct {
+			SourceID string `json:"source_id"`
+			Title    string `json:"title"`
+			Reason   string `json:"reason"`
+		} `json:"unmatched"`
+	}
+	json.NewDecoder(resp.Body).Decode(&report)
+
+	fmt.Printf("Imported %d of %d entries (%d by id, %d by title)\n",
+		report.Imported, report.Total, report.ByID, report.ByTitle)
+
+	if len(report.Unmatched) > 0 {
+		fmt.Println("\nUnmatched:")
+		for _, u := range report.Unmatched {
+			fmt.Printf("- %s [%s] %s\n", u.Title, u.SourceID, u.Reason)
+		}
+	}
+
+	input("\nPress Enter to continue...")
+}
+
+func exportLibrary() {
+	clearScreen()
+	printHeader("EXPORT LIBRARY")
+
+	format := strings.ToLower(input("Format (mal/csv/json, default json): "))
+	if format == "" {
+		format = "json"
+	}
+
+	ext := format
+	if format == "mal" {
+		ext = "xml"
+	}
+	path := input("Save to (default mangahub-library." + ext + "): ")
+	if path == "" {
+		path = "mangahub-library." + ext
+	}
+
+	query := "?format=" + url.QueryEscape(format)
+	if format == "mal" {
+		// MAL only knows its own ids, which we have for imported manga
+		if strings.EqualFold(input("Skip entries without a MAL id? (y/N): "), "y") {
+			query += "&skip_unknown=true"
+		}
+	}
+
+	req, _ := http.NewRequest("GET", HTTP_API+"/users/library/export"+query, nil)
+
+	resp, err := doAuthRequest(req)
+	if err != nil {
+		fmt.Println("Request failed:", err)
+		time.Sleep(time.Second)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var res struct {
+			Error   string `json:"error"`
+			Missing []struct {
+				Title string `json:"title"`
+			} `json:"missing"`
+		}
+		json.NewDecoder(resp.Body).Decode(&res)
+		fmt.Println("Export failed:", res.Error)
+		for _, m := range res.Missing {
+			fmt.Println("-", m.Title)
+		}
+		input("\nPress Enter to continue...")
+		return
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Cannot create file:", err)
+		time.Sleep(time.Second)
+		return
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		fmt.Println("Write failed:", err)
+		time.Sleep(time.Second)
+		return
+	}
+
+	fmt.Printf("Saved %d bytes to %s\n", n, path)
+	if skipped := resp.Header.Get("X-Export-Skipped"); skipped != "" && skipped != "0" {
+		fmt.Println("Skipped", skipped, "entries without a MAL id")
+	}
+	input("\nPress Enter to continue...")
+}
+
+// ==================================
+// Sessions (logged in devices)
+// ==================================
+type session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	IP         string    `json:"ip"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+func sessionsMenu() {
+	for {
+		clearScreen()
+		printHeader("SESSIONS")
+
+		req, _ := http.NewRequest("GET", HTTP_API+"/users/sessions", nil)
+		resp, err := doAuthRequest(req)
+		if err != nil {
+			fmt.Println("Request failed:", err)
+			time.Sleep(time.Second)
+			return
+		}
+		var list []session
+		json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+
+		for i, s := range list {
+			mark := ""
+			if s.Current {
+				mark = " (this device)"
+			}
+			fmt.Printf("%d) %s%s\n   %s, last active %s\n",
+				i+1, s.DeviceName, mark, s.IP, s.LastUsedAt.Local().Format("2006-01-02 15:04"))
+		}
+
+		fmt.Println("\nOptions:")
+		fmt.Println("number) LOG OUT THAT DEVICE")
+		fmt.Println("o) LOG OUT ALL OTHER DEVICES")
+		fmt.Println("t) TWO-FACTOR AUTHENTICATION")
+		fmt.Println("Enter) MAIN MENU")
+
+		choice := strings.ToLower(input("> "))
+		switch {
+		case choice == "t":
+			twoFactorMenu()
+		case choice == "o":
+			req, _ := http.NewRequest("DELETE", HTTP_API+"/users/sessions", nil)
+			printSessionReply(doAuthRequest(req))
+		case choice != "":
+			n, err := strconv.Atoi(choice)
+			if err != nil || n < 1 || n > len(list) {
+				fmt.Println("Invalid choice.")
+				time.Sleep(time.Second)
+				continue
+			}
+			if list[n-1].Current {
+				fmt.Println("Use LOGOUT to end this session.")
+				time.Sleep(time.Second)
+				continue
+			}
+			req, _ := http.NewRequest("DELETE", HTTP_API+"/users/sessions/"+list[n-1].ID, nil)
+			printSessionReply(doAuthRequest(req))
+		default:
+			return
+		}
+	}
+}
+
+func twoFactorMenu() {
+	clearScreen()
+	printHeader("TWO-FACTOR AUTHENTICATION")
+
+	var status struct {
+		Enabled           bool `json:"enabled"`
+		RecoveryCodesLeft int  `json:"recovery_codes_left"`
+		Required          bool `json:"required"`
+	}
+	if authJSON("GET", "/users/me/2fa", nil, &status) != http.StatusOK {
+		time.Sleep(time.Second)
+		return
+	}
+
+	if !status.Enabled {
+		fmt.Println("Two-factor authentication is off.")
+		if !strings.EqualFold(input("Turn it on? (y/N): "), "y") {
+			return
+		}
+
+		var enroll map[string]interface{}
+		if authJSON("POST", "/users/me/2fa/enroll", nil, &enroll) != http.StatusOK {
+			time.Sleep(time.Second)
+			return
+		}
+		fmt.Println("Add this to your authenticator app:")
+		fmt.Println("  ", enroll["otpauth_uri"])
+		fmt.Println("or enter the key by hand:", enroll["secret"])
+
+		var res map[string]interface{}
+		code := input("Code from the app: ")
+		if authJSON("POST", "/users/me/2fa/verify", map[string]string{"code": code}, &res) == http.StatusOK {
+			fmt.Println(res["message"])
+			if codes, ok := res["recovery_codes"].([]interface{}); ok {
+				printRecoveryCodes(codes)
+			}
+		}
+		input("Press Enter to continue...")
+		return
+	}
+
+	fmt.Printf("Two-factor authentication is on, %d recovery codes left.\n", status.RecoveryCodesLeft)
+	fmt.Println("1) NEW RECOVERY CODES")
+	if !status.Required {
+		fmt.Println("2) TURN OFF")
+	}
+	fmt.Println("Enter) BACK")
+
+	switch input("> ") {
+	case "1":
+		var res map[string]interface{}
+		code := input("Authentication code: ")
+		if authJSON("POST", "/users/me/2fa/recovery-codes", map[string]string{"code": code}, &res) == http.StatusOK {
+			if codes, ok := res["recovery_codes"].([]interface{}); ok {
+				printRecoveryCodes(codes)
+			}
+		}
+		input("Press Enter to continue...")
+	case "2":
+		if status.Required {
+			return
+		}
+		var res map[string]interface{}
+		code := input("Authentication code: ")
+		if authJSON("DELETE", "/users/me/2fa", map[string]string{"code": code}, &res) == http.StatusOK {
+			fmt.Println(res["message"])
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// authJSON sends an authenticated request and decodes the reply,
+// printing the server's error when there is one.
+func authJSON(method, path string, payload, out interface{}) int {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, HTTP_API+path, body)
+	resp, err := doAuthRequest(req)
+	if err != nil {
+		fmt.Println("Request failed:", err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		fmt.Println("Failed:", e.Error)
+		return resp.StatusCode
+	}
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func printSessionReply(resp *http.Response, err error) {
+	if err != nil {
+		fmt.Println("Request failed:", err)
+		time.Sleep(time.Second)
+		return
+	}
+	defer resp.Body.Close()
+
+	var res map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&res)
+	if msg, ok := res["message"]; ok {
+		fmt.Println(msg)
+	} else {
+		fmt.Println("Failed:", res["error"])
+	}
+	time.Sleep(time.Second)
+}
+
 // ==================================
 // Menus
 // ==================================
 func mainMenu() {
 	clearScreen()
 	for {
+		if accessToken == "" {
+			// session revoked from another device
+			return
+		}
 		printHeader("MAIN MENU")
 		fmt.Println("Options:")
 		fmt.Println("1) SEARCH")
 		fmt.Println("2) MANGA INFO")
 		fmt.Println("3) UPDATE_PROGRESS")
-		fmt.Println("4) LOGOUT")
-		fmt.Println("5) EXIT")
+		fmt.Println("4) LIBRARY")
+		fmt.Println("5) SESSIONS")
+		fmt.Println("6) LOGOUT")
+		fmt.Println("7) EXIT")
 
 		cmd := strings.ToLower(input("> "))
 
@@ -436,10 +928,14 @@ func mainMenu() {
 		case "3", "progress":
 			updateProgressHTTP()
 			lastMangaID = ""
-		case "4", "logout":
+		case "4", "library", "import", "export":
+			libraryMenu()
+		case "5", "sessions":
+			sessionsMenu()
+		case "6", "logout":
 			logoutUser()
 			return
-		case "5", "exit":
+		case "7", "exit":
 			os.Exit(0)
 		}
 	}
@@ -453,7 +949,8 @@ func welcomeMenu() {
 		fmt.Println("Options:")
 		fmt.Println("1) REGISTER")
 		fmt.Println("2) LOGIN")
-		fmt.Println("3) EXIT")
+		fmt.Println("3) FORGOT PASSWORD")
+		fmt.Println("4) EXIT")
 
 		cmd := strings.ToLower(input("> "))
 
@@ -465,7 +962,9 @@ func welcomeMenu() {
 			if accessToken != "" {
 				mainMenu()
 			}
-		case "exit", "3":
+		case "forgot", "3":
+			forgotPassword()
+		case "exit", "4":
 			os.Exit(0)
 		default:
 			fmt.Println("Invalid choice.")
@@ -488,6 +987,16 @@ func initGRPC() {
 
 var udpConn *net.UDPConn
 
+// registerUDPSession re-registers with the access token so the server
+// can tell this client when its session is revoked.
+func registerUDPSession() {
+	if udpConn == nil {
+		return
+	}
+	data, _ := json.Marshal(map[string]string{"type": "REGISTER", "token": accessToken})
+	udpConn.Write(data)
+}
+
 func startUDP() {
 	serverAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:9091")
 	if err != nil {
@@ -547,6 +1056,12 @@ func startUDP() {
 				default:
 				}
 
+			case "SESSION_REVOKED":
+				accessToken = ""
+				refreshToken = ""
+				currentUser = ""
+				fmt.Println("\n⚠ This session was logged out from another device. Press Enter to continue.")
+
 			case "NOTIFY", "NEW_MANGA", "manga_added", "chapter_release":
 				text := msg.Message
 				if text == "" && msg.Title != "" {
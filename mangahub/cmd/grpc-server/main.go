@@ -8,8 +8,13 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"mangahub/internal/auth"
 	grpcinternal "mangahub/internal/grpc"
+	"mangahub/internal/manga"
+	"mangahub/internal/ratelimit"
+	"mangahub/internal/recommend"
 	"mangahub/pkg/database"
 	pb "mangahub/proto/manga"
 
@@ -25,6 +30,11 @@ func main() {
 	addr := flag.String("addr", ":9092", "gRPC listen address")
 	flag.Parse()
 
+	// tokens are checked against the API server's public keys
+	if err := auth.LoadVerifyKeys(); err != nil {
+		log.Fatalf("JWT keys: %v", err)
+	}
+
 	// init DB (reuse your package)
 	dbPath, _ := filepath.Abs("mangahub.db")
 	db := database.InitDB(dbPath)
@@ -37,8 +47,19 @@ func main() {
 	}
 
 	log.Println("grpc DB path:", dbPath)
-	grpcServer := grpc.NewServer()
-	svc := &grpcinternal.GRPCMangaServer{DB: db}
+	limits, err := ratelimit.FromEnv()
+	if err != nil {
+		log.Fatalf("rate limits: %v", err)
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		grpcinternal.AuthInterceptor(db),
+		grpcinternal.RateLimit(limits),
+		grpcinternal.RequirePermission(grpcinternal.RPCPermissions),
+	))
+	recommender := recommend.NewEngine(db)
+	recommender.Start(5 * time.Minute)
+
+	svc := &grpcinternal.GRPCMangaServer{DB: db, Catalog: manga.NewCatalog(db, nil), Recommender: recommender}
 	pb.RegisterMangaServiceServer(grpcServer, svc)
 
 	// Health check service
@@ -0,0 +1,250 @@
+// mock-idp is a tiny OpenID Connect provider for trying external login
+// locally. It accepts any username without a password. Do not expose it.
+//
+//	go run ./cmd/mock-idp
+//	OIDC_PROVIDERS=oidc_providers.json go run ./cmd/api-server
+//
+// with oidc_providers.json:
+//
+//	[{"name": "mock", "display_name": "Mock IdP",
+//	  "issuer": "http://localhost:9096",
+//	  "client_id": "mangahub", "client_secret": "mock-secret"}]
+//
+// Adding login_hint=<username> to the authorize URL skips the form,
+// which is handy from scripts.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type grant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	challenge     string
+	username      string
+	email         string
+	emailVerified bool
+	expires       time.Time
+}
+
+var (
+	addr         = flag.String("addr", ":9096", "listen address")
+	issuer       = flag.String("issuer", "http://localhost:9096", "issuer URL, as clients reach it")
+	clientID     = flag.String("client-id", "mangahub", "the only client")
+	clientSecret = flag.String("client-secret", "mock-secret", "client secret, empty for a public client")
+
+	key *rsa.PrivateKey
+	kid = "mock-1"
+
+	mu     sync.Mutex
+	grants = map[string]*grant{} // code -> grant
+)
+
+var form = template.Must(template.New("form").Parse(`<!doctype html>
+<title>Mock IdP</title>
+<h1>Mock IdP</h1>
+<p>Log in to <b>{{.ClientID}}</b> as anyone.</p>
+<form method="post">
+  {{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">{{end}}
+  <p><label>Username <input name="username" required></label></p>
+  <p><label>Email <input name="email" type="email"></label></p>
+  <p><label><input name="email_verified" type="checkbox" checked> email verified</label></p>
+  <p><button>Log in</button></p>
+</form>
+`))
+
+func main() {
+	flag.Parse()
+	*issuer = strings.TrimRight(*issuer, "/")
+
+	var err error
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", discovery)
+	http.HandleFunc("/authorize", authorize)
+	http.HandleFunc("/token", token)
+	http.HandleFunc("/jwks", jwks)
+
+	log.Printf("mock IdP %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]any{
+		"issuer":                                *issuer,
+		"authorization_endpoint":                *issuer + "/authorize",
+		"token_endpoint":                        *issuer + "/token",
+		"jwks_uri":                              *issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func jwks(w http.ResponseWriter, r *http.Request) {
+	pub := key.PublicKey
+	writeJSON(w, 200, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// authorize shows the login form (GET) and hands out a code (POST, or
+// GET with login_hint).
+func authorize(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	q := r.Form
+
+	if q.Get("client_id") != *clientID || q.Get("response_type") != "code" {
+		http.Error(w, "unknown client or response_type", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	username := q.Get("username")
+	email, verified := q.Get("email"), q.Get("email_verified") != ""
+	if username == "" && q.Get("login_hint") != "" && r.Method == http.MethodGet {
+		username = q.Get("login_hint")
+		email, verified = username+"@mock.example", true
+	}
+	if username == "" {
+		params := url.Values{}
+		for _, k := range []string{"client_id", "response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params.Set(k, q.Get(k))
+		}
+		form.Execute(w, map[string]any{"ClientID": *clientID, "Params": params})
+		return
+	}
+
+	code := randomString()
+	mu.Lock()
+	grants[code] = &grant{
+		clientID:      *clientID,
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		challenge:     q.Get("code_challenge"),
+		username:      username,
+		email:         email,
+		emailVerified: verified,
+		expires:       time.Now().Add(time.Minute),
+	}
+	mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != *clientID || secret != *clientSecret {
+		writeJSON(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	mu.Lock()
+	g := grants[code]
+	delete(grants, code)
+	mu.Unlock()
+
+	if g == nil || time.Now().After(g.expires) || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI {
+		writeJSON(w, 400, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                *issuer,
+		"sub":                "mock|" + g.username,
+		"aud":                g.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              g.nonce,
+		"preferred_username": g.username,
+		"name":               g.username,
+	}
+	if g.email != "" {
+		claims["email"] = g.email
+		claims["email_verified"] = g.emailVerified
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = kid
+	idToken, err := t.SignedString(key)
+	if err != nil {
+		writeJSON(w, 500, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, 200, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -2,11 +2,24 @@ package main
 
 import (
 	"log"
+	"mangahub/internal/auth"
+	"mangahub/internal/ratelimit"
 	"mangahub/internal/tcp"
 )
 
 func main() {
+	// tokens are checked against the API server's public keys
+	if err := auth.LoadVerifyKeys(); err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
+
+	limits, err := ratelimit.FromEnv()
+	if err != nil {
+		log.Fatal("rate limits: ", err)
+	}
+
 	server := tcp.NewProgressSyncServer(":9090")
+	server.Limits = limits
 	log.Println("Starting TCP Sync Server on :9090")
 	if err := server.Start(); err != nil {
 		log.Fatal(err)
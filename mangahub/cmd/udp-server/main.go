@@ -7,11 +7,24 @@ import (
 	"net/http"
 	"time"
 
+	"mangahub/internal/auth"
+	"mangahub/internal/ratelimit"
 	"mangahub/internal/udp"
 )
 
 func main() {
+	// tokens are checked against the API server's public keys
+	if err := auth.LoadVerifyKeys(); err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
+
+	limits, err := ratelimit.FromEnv()
+	if err != nil {
+		log.Fatal("rate limits: ", err)
+	}
+
 	server := udp.NewNotificationServer(":9091")
+	server.Limits = limits
 
 	// Start UDP server (client registration)
 	go func() {
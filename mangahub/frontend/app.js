@@ -149,3 +149,60 @@ async function loadMangaDetails() {
     document.getElementById("description").innerText = m.description;
 }
 loadMangaDetails();
+
+/* ------------------- DASHBOARD RANKINGS ------------------- */
+function fillRanking(list, items) {
+    list.innerHTML = "";
+
+    if (items.length === 0) {
+        list.innerHTML = "<li>Nothing yet</li>";
+        return;
+    }
+
+    items.forEach(m => {
+        const li = document.createElement("li");
+        li.innerHTML = `<a href="manga.html?id=${m.manga_id}">${m.title}</a> <small>${m.author}</small>`;
+        list.appendChild(li);
+    });
+}
+
+async function loadTrending(window) {
+    const list = document.getElementById("trendingList");
+    if (!list) return; // Not on dashboard.html
+
+    const res = await fetch(API + "/manga/trending?limit=10&window=" + (window || "7d"));
+    const data = await res.json();
+    fillRanking(list, data.manga || []);
+}
+loadTrending("7d");
+
+async function loadPopular() {
+    const list = document.getElementById("popularList");
+    if (!list) return;
+
+    const res = await fetch(API + "/manga/popular?limit=10");
+    const data = await res.json();
+    fillRanking(list, data.manga || []);
+}
+loadPopular();
+
+async function loadActivity() {
+    const feed = document.getElementById("activityFeed");
+    if (!feed) return;
+
+    const res = await fetch(API + "/manga/latest-activity?limit=10");
+    const items = await res.json();
+
+    feed.innerHTML = "";
+    if (items.length === 0) {
+        feed.innerHTML = "<li>No activity yet</li>";
+        return;
+    }
+
+    items.forEach(a => {
+        const li = document.createElement("li");
+        li.innerHTML = `<a href="manga.html?id=${a.manga_id}">${a.message}</a> <small>${a.created_at}</small>`;
+        feed.appendChild(li);
+    });
+}
+loadActivity();
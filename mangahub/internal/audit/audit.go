@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The audit log answers "who did that": admin changes to the catalog
+// and to users, logins, lockouts and revoked sessions. Rows are only
+// ever inserted; triggers in the schema refuse updates and deletes.
+
+// Entry is one line of the audit log. Before and After are stored as
+// JSON and may be nil. ActorID is empty when nobody was logged in, for
+// example a lockout caused by failed logins.
+type Entry struct {
+	ActorID    string
+	ActorName  string
+	Action     string // e.g. "auth.lockout"
+	TargetType string // e.g. "user", "manga"
+	TargetID   string
+	IP         string
+	Before     any
+	After      any
+}
+
+// FromRequest starts an entry for the logged in user making the
+// request, from the claims AuthMiddleware put on the context.
+func FromRequest(c *gin.Context, action, targetType, targetID string) Entry {
+	return Entry{
+		ActorID:    c.GetString("user_id"),
+		ActorName:  c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+	}
+}
+
+// Record appends e to the audit log. The log is only ever added to.
+func Record(db *sql.DB, e Entry) error {
+	before, err := encode(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encode(e.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO audit_log (created_at, actor_id, actor_name, action, target_type, target_id, ip, before_json, after_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, time.Now().UTC(), e.ActorID, e.ActorName, e.Action, e.TargetType, e.TargetID, e.IP, before, after)
+	if err != nil {
+		// losing an audit line should be loud, but not fail the request
+		log.Printf("audit: %s %s/%s: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+	return err
+}
+
+func encode(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	if string(b) == "null" { // a nil pointer in an interface
+		return sql.NullString{}, nil
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// Event is an audit log row as the admin API returns it.
+type Event struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    string          `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IP         string          `json:"ip"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// Filter narrows a query. Empty fields match everything. Action
+// matches a prefix when it ends in ".", so "auth." finds every auth
+// event. Events come newest first; BeforeID pages back from an id.
+type Filter struct {
+	Actor      string // id or username
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	Since      time.Time
+	Until      time.Time
+	BeforeID   int64
+	Limit      int // 0 means no limit
+}
+
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Actor != "" {
+		conds = append(conds, "(actor_id = ? OR actor_name = ?)")
+		args = append(args, f.Actor, f.Actor)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		conds = append(conds, "action LIKE ? ESCAPE '\\'")
+		args = append(args, strings.NewReplacer("%", "\\%", "_", "\\_").Replace(f.Action)+"%")
+	} else if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	if f.BeforeID > 0 {
+		conds = append(conds, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Each calls fn for every event matching f, newest first, and stops at
+// the first error fn returns.
+func Each(db *sql.DB, f Filter, fn func(Event) error) error {
+	where, args := f.where()
+	query := `
+		SELECT id, created_at, COALESCE(actor_id, ''), COALESCE(actor_name, ''), action,
+		       COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(ip, ''),
+		       before_json, after_json
+		FROM audit_log ` + where + ` ORDER BY id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Event
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorID, &e.ActorName, &e.Action,
+			&e.TargetType, &e.TargetID, &e.IP, &before, &after); err != nil {
+			return err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// List returns the events matching f.
+func List(db *sql.DB, f Filter) ([]Event, error) {
+	list := []Event{}
+	err := Each(db, f, func(e Event) error {
+		list = append(list, e)
+		return nil
+	})
+	return list, err
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes = reading the audit log. The caller guards r, the
+// log is for admins only.
+func RegisterAdminRoutes(r gin.IRouter, db *sql.DB) {
+
+	// GET /admin/audit?actor=&action=&target_type=&target_id=&ip=&since=&until=&before_id=&limit=
+	// since / until are RFC3339; format=jsonl downloads every match
+	r.GET("/audit", func(c *gin.Context) {
+		f, ok := parseFilter(c)
+		if !ok {
+			return
+		}
+
+		if c.Query("format") == "jsonl" {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102-150405")+`.jsonl"`)
+			c.Status(200)
+			enc := json.NewEncoder(c.Writer)
+			if err := Each(db, f, func(e Event) error { return enc.Encode(e) }); err != nil {
+				// headers are out already, all we can do is stop
+				c.Error(err)
+			}
+			return
+		}
+
+		if f.Limit <= 0 || f.Limit > 500 {
+			f.Limit = 100
+		}
+		list, err := List(db, f)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		res := gin.H{"events": list}
+		if len(list) == f.Limit {
+			res["next_before_id"] = list[len(list)-1].ID
+		}
+		c.JSON(200, res)
+	})
+}
+
+func parseFilter(c *gin.Context) (Filter, bool) {
+	f := Filter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		IP:         c.Query("ip"),
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+	f.BeforeID, _ = strconv.ParseInt(c.Query("before_id"), 10, 64)
+
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(400, gin.H{"error": name + " must be an RFC3339 time"})
+				return f, false
+			}
+			*dst = t
+		}
+	}
+	return f, true
+}
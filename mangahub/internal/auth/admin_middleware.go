@@ -1,30 +1,67 @@
 package auth
 
 import (
-	"log"
-
 	"github.com/gin-gonic/gin"
 )
 
+func claimsFrom(c *gin.Context) (*Claims, bool) {
+	claimsAny, ok := c.Get("claims")
+	if !ok {
+		c.JSON(401, gin.H{"error": "missing claims"})
+		c.Abort()
+		return nil, false
+	}
+	return claimsAny.(*Claims), true
+}
+
 func AdminOnly() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		claimsAny, ok := c.Get("claims")
+		claims, ok := claimsFrom(c)
 		if !ok {
-			c.JSON(401, gin.H{"error": "missing claims"})
+			return
+		}
+		if claims.Role != RoleAdmin {
+			c.JSON(403, gin.H{"error": "admin only"})
 			c.Abort()
 			return
 		}
 
-		claims := claimsAny.(*Claims)
-		log.Println("ADMIN CHECK ROLE =", claims.Role)
+		c.Next()
+	}
+}
 
-		if claims.Role != "admin" {
-			c.JSON(403, gin.H{"error": "admin only"})
+// StaffOnly lets in any role with at least one permission. It guards
+// /admin as a whole; routes then ask for the permission they need.
+func StaffOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFrom(c)
+		if !ok {
+			return
+		}
+		if claims.Role != RoleAdmin && len(claims.Permissions) == 0 {
+			c.JSON(403, gin.H{"error": "staff only"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequirePermission lets the request through only if the caller's role
+// has every one of perms. Runs after AuthMiddleware.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFrom(c)
+		if !ok {
+			return
+		}
+		for _, p := range perms {
+			if !claims.Can(p) {
+				c.JSON(403, gin.H{"error": "missing permission " + p})
+				c.Abort()
+				return
+			}
+		}
 		c.Next()
 	}
 }
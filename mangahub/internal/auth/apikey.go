@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Personal API keys let scripts authenticate without a password and
+// without refreshing tokens every minute. A key acts as its owner, but
+// only within its scopes. Only the SHA-256 of a key is stored; the key
+// itself is shown once, when it is created.
+
+const APIKeyPrefix = "mhk_"
+
+const (
+	ScopeCatalogRead   = "catalog:read"   // GET requests, gRPC reads
+	ScopeProgressWrite = "progress:write" // reading progress and library
+	ScopeAdmin         = "admin"          // /admin, only for staff roles
+)
+
+const (
+	maxAPIKeyName     = 50
+	maxAPIKeysPerUser = 20
+	maxAPIKeyDays     = 365
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyExpired  = errors.New("api key expired")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+	ErrScopeForbidden = errors.New("scope not allowed for this account")
+)
+
+func ValidScope(s string) bool {
+	return s == ScopeCatalogRead || s == ScopeProgressWrite || s == ScopeAdmin
+}
+
+// APIKey is a key as its owner sees it, without the secret.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters, to tell keys apart
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+// APIKeyRequest describes a key to create. ExpiresInDays 0 means the
+// key does not expire.
+type APIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// Validate trims the request in place and returns a message for the
+// first invalid field, or "".
+func (r *APIKeyRequest) Validate() string {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > maxAPIKeyName {
+		return "name must be 1 to 50 characters"
+	}
+	if len(r.Scopes) == 0 {
+		return "at least one scope is required"
+	}
+	for _, s := range r.Scopes {
+		if !ValidScope(s) {
+			return "unknown scope " + s
+		}
+	}
+	if r.ExpiresInDays < 0 || r.ExpiresInDays > maxAPIKeyDays {
+		return "expires_in_days must be between 0 (never) and 365"
+	}
+	return ""
+}
+
+// CreateAPIKey stores a new key and returns it with the secret, which
+// cannot be looked up again later.
+func CreateAPIKey(db *sql.DB, userID, role string, req APIKeyRequest) (*APIKey, string, error) {
+	for _, s := range req.Scopes {
+		if s == ScopeAdmin && len(RolePermissions(db, role)) == 0 {
+			return nil, "", ErrScopeForbidden
+		}
+	}
+
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE user_id = ?`, userID).Scan(&n)
+	if n >= maxAPIKeysPerUser {
+		return nil, "", ErrTooManyAPIKeys
+	}
+
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := APIKeyPrefix + secret
+
+	k := &APIKey{
+		ID:        uuid.NewString(),
+		Name:      req.Name,
+		Prefix:    key[:len(APIKeyPrefix)+6],
+		Scopes:    dedupe(req.Scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+	var expires sql.NullTime
+	if req.ExpiresInDays > 0 {
+		t := k.CreatedAt.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		k.ExpiresAt = &t
+		expires = sql.NullTime{Time: t, Valid: true}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, k.ID, userID, k.Name, k.Prefix, hashToken(key), strings.Join(k.Scopes, ","), k.CreatedAt, expires)
+	if err != nil {
+		return nil, "", err
+	}
+	return k, key, nil
+}
+
+// ListAPIKeys returns the user's keys, newest first.
+func ListAPIKeys(db *sql.DB, userID string) ([]APIKey, error) {
+	rows, err := db.Query(`
+		SELECT id, name, prefix, scopes, created_at, expires_at, last_used_at, COALESCE(last_used_ip, '')
+		FROM api_keys WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var scopes string
+		var expires, used sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &expires, &used, &k.LastUsedIP); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		if expires.Valid {
+			k.ExpiresAt = &expires.Time
+		}
+		if used.Valid {
+			k.LastUsedAt = &used.Time
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's keys.
+func DeleteAPIKey(db *sql.DB, userID, id string) error {
+	res, err := db.Exec(`DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey turns a key into claims for its owner, with the
+// key's scopes attached. Keys of suspended users stop working.
+func AuthenticateAPIKey(db *sql.DB, key, ip string) (*Claims, error) {
+	var claims Claims
+	var scopes string
+	var expires, lastUsed, verified sql.NullTime
+	err := db.QueryRow(`
+		SELECT k.id, k.user_id, k.scopes, k.expires_at, k.last_used_at,
+		       u.username, COALESCE(u.role, 'user'), u.email_verified_at
+		FROM api_keys k
+		JOIN users u ON CAST(u.id AS TEXT) = k.user_id
+		WHERE k.key_hash = ?
+	`, hashToken(key)).Scan(&claims.APIKeyID, &claims.UserID, &scopes, &expires, &lastUsed,
+		&claims.Username, &claims.Role, &verified)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expires.Valid && time.Now().After(expires.Time) {
+		return nil, ErrAPIKeyExpired
+	}
+	if s, _ := ActiveSuspension(db, claims.UserID); s != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// once a minute is plenty for "last used", and saves a write per call
+	if !lastUsed.Valid || time.Since(lastUsed.Time) > time.Minute {
+		db.Exec(`UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`,
+			time.Now().UTC(), ip, claims.APIKeyID)
+	}
+
+	claims.Scopes = strings.Split(scopes, ",")
+	claims.EmailVerified = verified.Valid
+	claims.Permissions = RolePermissions(db, claims.Role)
+	return &claims, nil
+}
+
+// Authenticate accepts either an access token or an API key.
+func Authenticate(db *sql.DB, credential, ip string) (*Claims, error) {
+	if strings.HasPrefix(credential, APIKeyPrefix) {
+		if db == nil {
+			return nil, ErrInvalidAPIKey
+		}
+		return AuthenticateAPIKey(db, credential, ip)
+	}
+	return ParseAccessToken(credential)
+}
+
+// HasScope reports whether the request may use scope. Access tokens
+// carry no scopes and may do anything their role allows.
+func (c *Claims) HasScope(scope string) bool {
+	if c.APIKeyID == "" {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// progressPaths are the routes a progress:write key may change.
+var progressPaths = []string{"/users/progress", "/users/library"}
+
+// accountPaths manage the account itself (keys, sessions, 2FA, email)
+// and are never open to keys.
+var accountPaths = []string{"/users/me/", "/users/sessions"}
+
+// apiKeyAllows maps HTTP requests onto key scopes. Anything else needs
+// a login.
+func apiKeyAllows(claims *Claims, method, path string) bool {
+	for _, p := range accountPaths {
+		if strings.HasPrefix(path, p) {
+			return false
+		}
+	}
+	if strings.HasPrefix(path, "/admin") {
+		return claims.HasScope(ScopeAdmin)
+	}
+	for _, p := range progressPaths {
+		if strings.HasPrefix(path, p) {
+			return claims.HasScope(ScopeProgressWrite)
+		}
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return claims.HasScope(ScopeCatalogRead)
+	}
+	return false
+}
+
+func dedupe(list []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrAdminExists = errors.New("an admin already exists")
+
+// BootstrapAdmin makes the first admin. An existing user is promoted
+// as is; otherwise a new account is created with password. It refuses
+// once any admin exists, so it cannot be used to take over a server.
+func BootstrapAdmin(db *sql.DB, username, password string) (created bool, err error) {
+	var admins int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, RoleAdmin).Scan(&admins); err != nil {
+		return false, err
+	}
+	if admins > 0 {
+		return false, ErrAdminExists
+	}
+
+	res, err := db.Exec(`UPDATE users SET role = ? WHERE username = ?`, RoleAdmin, username)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	if len(password) < minPasswordLength {
+		return false, ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+	_, err = db.Exec(`
+		INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)
+	`, username, hash, RoleAdmin)
+	return err == nil, err
+}
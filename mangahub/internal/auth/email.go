@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"mangahub/internal/mailer"
+)
+
+// Email tokens are single use and expire. Like refresh tokens only
+// their hash is stored. Verification tokens remember the address they
+// were sent to, so changing the address makes old links useless.
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+
+	purposeVerify = "verify"
+	purposeReset  = "reset"
+)
+
+var (
+	ErrInvalidEmail      = errors.New("invalid email address")
+	ErrEmailTaken        = errors.New("email already in use")
+	ErrNoEmail           = errors.New("no email address on the account")
+	ErrEmailVerified     = errors.New("email already verified")
+	ErrInvalidEmailToken = errors.New("invalid or expired token")
+)
+
+// NormalizeEmail checks a bare address like "a@b.c" and lowercases it.
+func NormalizeEmail(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+	return s, nil
+}
+
+// publicURL is where links in emails point, PUBLIC_URL or localhost.
+func publicURL() string {
+	if u := os.Getenv("PUBLIC_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://localhost:8080"
+}
+
+func isUniqueEmailErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "users.email")
+}
+
+func newEmailToken(db *sql.DB, userID, purpose, email string, ttl time.Duration) (string, error) {
+	// only the newest link of each kind works
+	if _, err := db.Exec(`
+		DELETE FROM email_tokens WHERE (user_id = ? AND purpose = ?) OR expires_at < ?
+	`, userID, purpose, time.Now().UTC()); err != nil {
+		return "", err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+		INSERT INTO email_tokens (token, user_id, purpose, email, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hash, userID, purpose, email, time.Now().UTC().Add(ttl))
+	return token, err
+}
+
+// consumeEmailToken uses up a token and returns who it was for.
+func consumeEmailToken(db *sql.DB, token, purpose string) (userID, email string, err error) {
+	hash := hashToken(token)
+	err = db.QueryRow(`
+		SELECT user_id, email FROM email_tokens
+		WHERE token = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, hash, purpose, time.Now().UTC()).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return "", "", ErrInvalidEmailToken
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	res, err := db.Exec(`
+		UPDATE email_tokens SET used_at = ? WHERE token = ? AND used_at IS NULL
+	`, time.Now().UTC(), hash)
+	if err != nil {
+		return "", "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", "", ErrInvalidEmailToken
+	}
+	return userID, email, nil
+}
+
+// SetEmail stores a new address and sends a link to verify it. Until
+// then the account counts as unverified.
+func SetEmail(db *sql.DB, m mailer.Mailer, userID, email string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?
+	`, email, userID)
+	if isUniqueEmailErr(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	return SendVerificationEmail(db, m, userID)
+}
+
+// SendVerificationEmail (re)sends the verification link.
+func SendVerificationEmail(db *sql.DB, m mailer.Mailer, userID string) error {
+	var username string
+	var email sql.NullString
+	var verified sql.NullTime
+	err := db.QueryRow(`
+		SELECT username, email, email_verified_at FROM users WHERE id = ?
+	`, userID).Scan(&username, &email, &verified)
+	if err != nil {
+		return err
+	}
+	if !email.Valid || email.String == "" {
+		return ErrNoEmail
+	}
+	if verified.Valid {
+		return ErrEmailVerified
+	}
+
+	token, err := newEmailToken(db, userID, purposeVerify, email.String, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return m.Send(mailer.Message{
+		To:      email.String,
+		Subject: "Confirm your MangaHub email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm this is your email address by opening:\n\n"+
+			"%s/auth/verify-email?token=%s\n\n"+
+			"The link works for 48 hours. If you did not sign up for MangaHub, ignore this email.\n",
+			username, publicURL(), token),
+	})
+}
+
+// VerifyEmail marks the address the token was sent to as verified.
+func VerifyEmail(db *sql.DB, token string) (userID string, err error) {
+	userID, email, err := consumeEmailToken(db, token, purposeVerify)
+	if err != nil {
+		return "", err
+	}
+	res, err := db.Exec(`
+		UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ?
+	`, time.Now().UTC(), userID, email)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// the address was changed after this link was sent
+		return "", ErrInvalidEmailToken
+	}
+	return userID, nil
+}
+
+// RequestPasswordReset mails a reset code to the verified address of
+// the account with this username or email. Unknown accounts are
+// ignored without an error, so callers cannot probe for them.
+func RequestPasswordReset(db *sql.DB, m mailer.Mailer, login string) error {
+	login = strings.TrimSpace(login)
+
+	var userID, username, email string
+	err := db.QueryRow(`
+		SELECT CAST(id AS TEXT), username, email FROM users
+		WHERE (username = ? OR email = ?) AND email IS NOT NULL AND email_verified_at IS NOT NULL
+	`, login, strings.ToLower(login)).Scan(&userID, &username, &email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := newEmailToken(db, userID, purposeReset, email, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return m.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your MangaHub password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset your MangaHub password. Your reset code is:\n\n"+
+			"%s\n\n"+
+			"Enter it when MangaHub asks for it, or POST it with a new password to\n"+
+			"%s/auth/reset-password. It works once, for one hour.\n\n"+
+			"If this was not you, ignore this email; your password has not changed.\n",
+			username, token, publicURL()),
+	})
+}
+
+// ResetPassword sets a new password with a reset code and logs the
+// account out everywhere.
+func ResetPassword(db *sql.DB, token, newPassword string) (userID string, err error) {
+	if len(newPassword) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+	userID, _, err = consumeEmailToken(db, token, purposeReset)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	var username string
+	if err := db.QueryRow(`SELECT username FROM users WHERE id = ?`, userID).Scan(&username); err != nil {
+		return "", err
+	}
+	if _, err := db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID); err != nil {
+		return "", err
+	}
+
+	// whoever was guessing the old password is not locking us out now
+	loginSucceeded(db, username)
+	return userID, RevokeAllSessions(db, userID)
+}
@@ -3,16 +3,27 @@ package auth
 import (
 	"database/sql"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/mailer"
 )
 
-func RegisterHandler(db *sql.DB) gin.HandlerFunc {
+// RegisterHandler creates an account. The email is optional, but the
+// account stays unverified, with fewer permissions, until an address
+// has been verified.
+func RegisterHandler(db *sql.DB, m mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username   string `json:"username"`
+			Password   string `json:"password"`
+			Email      string `json:"email"`
+			DeviceName string `json:"device_name"`
 		}
 
 		if err := c.BindJSON(&req); err != nil {
@@ -20,13 +31,27 @@ func RegisterHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		var email sql.NullString
+		if req.Email != "" {
+			e, err := NormalizeEmail(req.Email)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			email = sql.NullString{String: e, Valid: true}
+		}
+
 		hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 
 		res, err := db.Exec(`
-			INSERT INTO users (username, password_hash, role)
-			VALUES (?, ?, 'user')
-		`, req.Username, hash)
+			INSERT INTO users (username, password_hash, role, email)
+			VALUES (?, ?, 'user', ?)
+		`, req.Username, hash, email)
 
+		if isUniqueEmailErr(err) {
+			c.JSON(409, gin.H{"error": ErrEmailTaken.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(409, gin.H{"error": "username exists"})
 			return
@@ -35,12 +60,22 @@ func RegisterHandler(db *sql.DB) gin.HandlerFunc {
 		id, _ := res.LastInsertId()
 		userID := fmt.Sprintf("%d", id)
 
-		access, _ := CreateAccessToken(userID, req.Username, "user")
-		refresh, _ := CreateRefreshToken(db, userID)
+		sent := false
+		if email.Valid {
+			if err := SendVerificationEmail(db, m, userID); err != nil {
+				log.Println("verification email:", err)
+			} else {
+				sent = true
+			}
+		}
+
+		sessionID, refresh, _ := CreateSession(db, userID, DeviceFromRequest(c, req.DeviceName))
+		access, _ := AccessTokenFor(db, userID, sessionID)
 
 		c.JSON(201, gin.H{
-			"access_token":  access,
-			"refresh_token": refresh,
+			"access_token":            access,
+			"refresh_token":           refresh,
+			"email_verification_sent": sent,
 		})
 	}
 }
@@ -48,8 +83,9 @@ func RegisterHandler(db *sql.DB) gin.HandlerFunc {
 func LoginHandler(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username   string `json:"username"`
+			Password   string `json:"password"`
+			DeviceName string `json:"device_name"`
 		}
 
 		if err := c.BindJSON(&req); err != nil {
@@ -57,29 +93,187 @@ func LoginHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		if wait := lockedFor(db, req.Username); wait > 0 {
+			lockedResponse(c, wait)
+			return
+		}
+
 		var id int
 		var hash, role string
 
-		err := db.QueryRow(`
+		// an unknown user still costs a bcrypt check, see checkPassword
+		db.QueryRow(`
 			SELECT id, password_hash, role
 			FROM users
 			WHERE username = ?
 		`, req.Username).Scan(&id, &hash, &role)
 
-		if err != nil || bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		if !checkPassword(hash, req.Password) {
+			audit.Record(db, audit.Entry{
+				Action:     "auth.login_failed",
+				TargetType: "user",
+				TargetID:   req.Username,
+				IP:         c.ClientIP(),
+			})
+			if wait := loginFailed(db, req.Username, c.ClientIP()); wait > 0 {
+				lockedResponse(c, wait)
+				return
+			}
 			c.JSON(401, gin.H{"error": "invalid credentials"})
 			return
 		}
 
 		userID := fmt.Sprintf("%d", id)
 
-		access, _ := CreateAccessToken(userID, req.Username, role)
-		refresh, _ := CreateRefreshToken(db, userID)
+		if s, _ := ActiveSuspension(db, userID); s != nil {
+			c.JSON(403, suspendedResponse(s))
+			return
+		}
 
-		c.JSON(200, gin.H{
+		// password was right, tokens may still wait for the second factor
+		if startSession(c, db, userID, role, req.DeviceName, "password", nil) {
+			loginSucceeded(db, req.Username)
+		}
+	}
+}
+
+// startSession finishes a login whose first factor checked out. It
+// either asks for the second factor or issues tokens, and reports
+// whether tokens were issued. extra is added to the response.
+func startSession(c *gin.Context, db *sql.DB, userID, role, deviceName, method string, extra gin.H) bool {
+	resp := gin.H{}
+	for k, v := range extra {
+		resp[k] = v
+	}
+
+	if needed, enroll := secondFactorNeeded(db, userID, role); needed {
+		challenge, err := newChallenge(db, userID, deviceName)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "could not start login"})
+			return false
+		}
+		resp["two_factor_required"] = true
+		resp["enroll"] = enroll
+		resp["challenge_token"] = challenge
+		resp["expires_in"] = int(challengeTTL.Seconds())
+		c.JSON(200, resp)
+		return false
+	}
+
+	sessionID, refresh, _ := CreateSession(db, userID, DeviceFromRequest(c, deviceName))
+	access, _ := AccessTokenFor(db, userID, sessionID)
+	recordLogin(c, db, userID, sessionID, method)
+
+	resp["access_token"] = access
+	resp["refresh_token"] = refresh
+	c.JSON(200, resp)
+	return true
+}
+
+// TwoFactorEnrollHandler starts 2FA enrollment for a login whose role
+// requires it but who has not set it up yet.
+func TwoFactorEnrollHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Challenge string `json:"challenge_token"`
+		}
+
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid input"})
+			return
+		}
+
+		ch, err := loadChallenge(db, req.Challenge)
+		if err != nil {
+			c.JSON(401, gin.H{"error": ErrInvalidChallenge.Error()})
+			return
+		}
+
+		secret, uri, err := BeginTOTPEnrollment(db, ch.userID)
+		if err == ErrTOTPEnabled {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": "could not start enrollment"})
+			return
+		}
+
+		c.JSON(200, gin.H{"secret": secret, "otpauth_uri": uri})
+	}
+}
+
+// TwoFactorVerifyHandler trades a login challenge and a code for the
+// real tokens. During enrollment the code also confirms the new secret
+// and the reply carries the recovery codes.
+func TwoFactorVerifyHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Challenge string `json:"challenge_token"`
+			Code      string `json:"code"`
+		}
+
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid input"})
+			return
+		}
+
+		ch, err := loadChallenge(db, req.Challenge)
+		if err != nil {
+			c.JSON(401, gin.H{"error": ErrInvalidChallenge.Error()})
+			return
+		}
+
+		var username string
+		if err := db.QueryRow(`
+			SELECT username FROM users WHERE id = ?
+		`, ch.userID).Scan(&username); err != nil {
+			c.JSON(500, gin.H{"error": "user not found"})
+			return
+		}
+
+		// wrong codes count towards the same lockout as wrong passwords
+		if wait := lockedFor(db, username); wait > 0 {
+			lockedResponse(c, wait)
+			return
+		}
+
+		var recoveryCodes []string
+		if totpEnabled(db, ch.userID) {
+			err = VerifySecondFactor(db, ch.userID, req.Code)
+		} else {
+			recoveryCodes, err = ConfirmTOTPEnrollment(db, ch.userID, req.Code)
+		}
+		switch {
+		case err == ErrInvalidCode:
+			challengeFailed(db, req.Challenge)
+			if wait := loginFailed(db, username, c.ClientIP()); wait > 0 {
+				lockedResponse(c, wait)
+				return
+			}
+			c.JSON(401, gin.H{"error": "invalid code"})
+			return
+		case err == ErrTOTPNotPending:
+			c.JSON(400, gin.H{"error": "start enrollment first"})
+			return
+		case err != nil:
+			c.JSON(500, gin.H{"error": "could not verify code"})
+			return
+		}
+		deleteChallenge(db, req.Challenge)
+		loginSucceeded(db, username)
+
+		sessionID, refresh, _ := CreateSession(db, ch.userID, DeviceFromRequest(c, ch.deviceName))
+		access, _ := AccessTokenFor(db, ch.userID, sessionID)
+		recordLogin(c, db, ch.userID, sessionID, "password+totp")
+
+		res := gin.H{
 			"access_token":  access,
 			"refresh_token": refresh,
-		})
+		}
+		if recoveryCodes != nil {
+			res["recovery_codes"] = recoveryCodes
+		}
+		c.JSON(200, res)
 	}
 }
 
@@ -94,29 +288,118 @@ func RefreshHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		userID, err := ValidateRefreshToken(db, req.Token)
-		if err != nil {
+		userID, sessionID, refresh, err := RotateRefreshToken(db, req.Token, c.ClientIP())
+		switch {
+		case err == ErrRefreshTokenReused:
+			c.JSON(401, gin.H{"error": "refresh token reused, session revoked"})
+			return
+		case err == ErrRefreshTokenExpired:
+			c.JSON(401, gin.H{"error": "refresh token expired"})
+			return
+		case err != nil:
 			c.JSON(401, gin.H{"error": "invalid refresh token"})
 			return
 		}
 
-		var username, role string
-		err = db.QueryRow(`
-			SELECT username, role
-			FROM users
-			WHERE id = ?
-		`, userID).Scan(&username, &role)
+		if s, _ := ActiveSuspension(db, userID); s != nil {
+			_ = RevokeRefreshToken(db, refresh)
+			c.JSON(403, suspendedResponse(s))
+			return
+		}
 
+		access, err := AccessTokenFor(db, userID, sessionID)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "user not found"})
 			return
 		}
 
-		access, _ := CreateAccessToken(userID, username, role)
-
 		c.JSON(200, gin.H{
-			"access_token": access,
+			"access_token":  access,
+			"refresh_token": refresh,
+		})
+	}
+}
+
+// VerifyEmailHandler handles the link from the verification email
+// (GET ?token=) and the same token POSTed as {"token": "..."}.
+func VerifyEmailHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if c.Request.Method == "POST" {
+			var req struct {
+				Token string `json:"token"`
+			}
+			if err := c.BindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "invalid input"})
+				return
+			}
+			token = req.Token
+		}
+
+		if _, err := VerifyEmail(db, token); err == ErrInvalidEmailToken {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": "could not verify email"})
+			return
+		}
+		c.JSON(200, gin.H{"message": "email verified"})
+	}
+}
+
+// ForgotPasswordHandler always answers the same way, whether or not the
+// account exists.
+func ForgotPasswordHandler(db *sql.DB, m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Login string `json:"login"` // username or email
+		}
+
+		if err := c.BindJSON(&req); err != nil || req.Login == "" {
+			c.JSON(400, gin.H{"error": "invalid input"})
+			return
+		}
+
+		if err := RequestPasswordReset(db, m, req.Login); err != nil {
+			log.Println("password reset:", err)
+		}
+		c.JSON(200, gin.H{"message": "if the account has a verified email, a reset code was sent to it"})
+	}
+}
+
+func ResetPasswordHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid input"})
+			return
+		}
+
+		userID, err := ResetPassword(db, req.Token, req.Password)
+		switch {
+		case err == ErrWeakPassword:
+			c.JSON(400, gin.H{"error": "password must be at least 6 characters"})
+			return
+		case err == ErrInvalidEmailToken:
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(500, gin.H{"error": "could not reset password"})
+			return
+		}
+
+		audit.Record(db, audit.Entry{
+			ActorID:    userID,
+			Action:     "auth.password_reset",
+			TargetType: "user",
+			TargetID:   userID,
+			IP:         c.ClientIP(),
 		})
+		c.JSON(200, gin.H{"message": "password changed, log in with the new password"})
 	}
 }
 
@@ -131,8 +414,141 @@ func LogoutHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		_ = RevokeRefreshToken(db, req.Token)
+		if userID, sessionID := refreshTokenOwner(db, req.Token); sessionID != "" {
+			_ = RevokeRefreshToken(db, req.Token)
+			audit.Record(db, audit.Entry{
+				ActorID:    userID,
+				Action:     "session.logout",
+				TargetType: "session",
+				TargetID:   sessionID,
+				IP:         c.ClientIP(),
+			})
+		}
 
 		c.JSON(200, gin.H{"message": "logged out"})
 	}
 }
+
+// OIDCProvidersHandler lists the external login providers.
+func OIDCProvidersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, OIDCProviders())
+	}
+}
+
+// OIDCLoginHandler sends the browser to the provider. Clients that ask
+// for JSON get the URL instead of a redirect.
+func OIDCLoginHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authURL, browser, err := BeginOIDC(db, c.Param("provider"), "", c.Query("device_name"))
+		if err == ErrUnknownProvider {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Println("oidc:", err)
+			c.JSON(502, gin.H{"error": "login provider unavailable"})
+			return
+		}
+		SetOIDCCookie(c, browser)
+
+		if strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.JSON(200, gin.H{"authorization_url": authURL})
+			return
+		}
+		c.Redirect(302, authURL)
+	}
+}
+
+// oidcCookie ties an OIDC flow to the browser that started it. It is
+// only sent to the callback, and SameSite=Lax still sends it on the
+// provider's redirect, which is a top-level navigation.
+const oidcCookie = "mangahub_oidc"
+
+// SetOIDCCookie stores the browser secret from BeginOIDC; an empty
+// value clears the cookie.
+func SetOIDCCookie(c *gin.Context, value string) {
+	maxAge := int(oidcLoginTTL.Seconds())
+	if value == "" {
+		maxAge = -1
+	}
+	secure := c.Request.TLS != nil || strings.HasPrefix(publicURL(), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, value, maxAge, "/auth/oidc/", "", secure, true)
+}
+
+// OIDCCallbackHandler is where the provider sends the user back to.
+// It logs the user in, or finishes linking a provider to a profile.
+func OIDCCallbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if e := c.Query("error"); e != "" {
+			c.JSON(400, gin.H{"error": "login was not completed: " + e})
+			return
+		}
+
+		browser, _ := c.Cookie(oidcCookie)
+		if browser == "" {
+			c.JSON(400, gin.H{"error": ErrOIDCOtherBrowser.Error()})
+			return
+		}
+
+		res, err := FinishOIDC(db, c.Param("provider"), c.Query("state"), c.Query("code"), browser)
+		switch err {
+		case nil:
+			SetOIDCCookie(c, "") // done with it
+		case ErrUnknownProvider:
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		case ErrInvalidOIDCState, ErrOIDCOtherBrowser:
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		case ErrOIDCEmailInUse, ErrIdentityLinked, ErrProviderLinked:
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		case ErrOIDCSignupClosed:
+			c.JSON(403, gin.H{"error": err.Error()})
+			return
+		default:
+			log.Println("oidc:", err)
+			c.JSON(502, gin.H{"error": "could not log in with the provider"})
+			return
+		}
+
+		if res.Linked {
+			audit.Record(db, audit.Entry{
+				ActorID:    res.UserID,
+				Action:     "identity.link",
+				TargetType: "user",
+				TargetID:   res.UserID,
+				IP:         c.ClientIP(),
+				After:      map[string]string{"provider": c.Param("provider")},
+			})
+			c.JSON(200, gin.H{"message": "provider linked", "provider": c.Param("provider")})
+			return
+		}
+
+		if s, _ := ActiveSuspension(db, res.UserID); s != nil {
+			c.JSON(403, suspendedResponse(s))
+			return
+		}
+
+		var role string
+		db.QueryRow(`SELECT COALESCE(role, 'user') FROM users WHERE id = ?`, res.UserID).Scan(&role)
+		startSession(c, db, res.UserID, role, res.DeviceName, "oidc:"+c.Param("provider"), gin.H{"account_created": res.Created})
+	}
+}
+
+// recordLogin puts a successful login in the audit log.
+func recordLogin(c *gin.Context, db *sql.DB, userID, sessionID, method string) {
+	var username string
+	db.QueryRow(`SELECT username FROM users WHERE id = ?`, userID).Scan(&username)
+	audit.Record(db, audit.Entry{
+		ActorID:    userID,
+		ActorName:  username,
+		Action:     "auth.login",
+		TargetType: "session",
+		TargetID:   sessionID,
+		IP:         c.ClientIP(),
+		After:      map[string]any{"method": method},
+	})
+}
@@ -0,0 +1,466 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Access tokens are signed with an RSA (RS256) or Ed25519 (EdDSA) key.
+// Only the API server holds the private key. Every token carries the
+// key id (kid) in its header, and verifiers look the public key up by
+// that id, either from PEM files or from the API server's
+// /.well-known/jwks.json.
+//
+// Rotating keys: generate a new key, point JWT_SIGNING_KEY at it and
+// add the old public key to JWT_VERIFY_KEYS until the last token signed
+// with it has expired.
+//
+//	JWT_SIGNING_KEY   private key PEM, as a file path or inline
+//	JWT_VERIFY_KEYS   comma separated PEM files of retired keys
+//	JWKS_URL          where verifiers fetch public keys from
+//
+// Without JWT_SIGNING_KEY the API server makes a throwaway key on
+// start. That is fine for development; access tokens are short lived
+// and refresh tokens do not depend on the key.
+
+const DefaultJWKSURL = "http://localhost:8080/.well-known/jwks.json"
+
+// how often verifiers may refetch the JWKS when they see an unknown kid
+const jwksRefetchInterval = 5 * time.Second
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.PrivateKey
+}
+
+type verifyKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+var keyring struct {
+	mu      sync.RWMutex
+	signing *signingKey
+	verify  map[string]verifyKey // kid -> key, includes the signing key
+	remote  *remoteKeys
+}
+
+// LoadKeys sets up the API server: the signing key, retired keys that
+// still verify, and optionally a JWKS to trust as well.
+func LoadKeys() error {
+	if v := os.Getenv("JWT_SIGNING_KEY"); v != "" {
+		priv, err := readPrivateKey(v)
+		if err != nil {
+			return fmt.Errorf("JWT_SIGNING_KEY: %w", err)
+		}
+		if err := setSigningKey(priv); err != nil {
+			return fmt.Errorf("JWT_SIGNING_KEY: %w", err)
+		}
+	} else {
+		log.Println("⚠ JWT_SIGNING_KEY not set, signing tokens with a throwaway key")
+		currentSigningKey()
+	}
+	return loadVerifyEnv(false)
+}
+
+// LoadVerifyKeys sets up a server that only checks tokens (gRPC, TCP,
+// UDP). Keys come from JWT_VERIFY_KEYS and JWKS_URL, and the JWKS
+// falls back to DefaultJWKSURL when neither is set.
+func LoadVerifyKeys() error {
+	return loadVerifyEnv(true)
+}
+
+func loadVerifyEnv(defaultJWKS bool) error {
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		pub, err := readPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("JWT_VERIFY_KEYS %s: %w", path, err)
+		}
+		if _, err := addVerifyKey(pub); err != nil {
+			return fmt.Errorf("JWT_VERIFY_KEYS %s: %w", path, err)
+		}
+	}
+
+	url := os.Getenv("JWKS_URL")
+	if url == "" && defaultJWKS && !haveVerifyKeys() {
+		url = DefaultJWKSURL
+	}
+	if url != "" {
+		UseJWKS(url)
+	}
+	return nil
+}
+
+// UseJWKS trusts the keys published at url, fetched in the background
+// now and again whenever a token names a kid we have not seen.
+func UseJWKS(url string) {
+	remote := &remoteKeys{url: url}
+	keyring.mu.Lock()
+	keyring.remote = remote
+	keyring.mu.Unlock()
+	go remote.warm()
+}
+
+func haveVerifyKeys() bool {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+	return len(keyring.verify) > 0
+}
+
+func setSigningKey(priv crypto.PrivateKey) error {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return errors.New("key cannot sign")
+	}
+	kid, err := addVerifyKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	method, _ := methodFor(signer.Public())
+
+	keyring.mu.Lock()
+	keyring.signing = &signingKey{kid: kid, method: method, key: priv}
+	keyring.mu.Unlock()
+	return nil
+}
+
+func currentSigningKey() *signingKey {
+	keyring.mu.RLock()
+	k := keyring.signing
+	keyring.mu.RUnlock()
+	if k != nil {
+		return k
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	if keyring.signing == nil {
+		kid, _ := keyID(priv.Public())
+		keyring.signing = &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, key: priv}
+		if keyring.verify == nil {
+			keyring.verify = make(map[string]verifyKey)
+		}
+		keyring.verify[kid] = verifyKey{jwt.SigningMethodEdDSA, priv.Public()}
+	}
+	return keyring.signing
+}
+
+func addVerifyKey(pub crypto.PublicKey) (string, error) {
+	method, err := methodFor(pub)
+	if err != nil {
+		return "", err
+	}
+	kid, err := keyID(pub)
+	if err != nil {
+		return "", err
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	if keyring.verify == nil {
+		keyring.verify = make(map[string]verifyKey)
+	}
+	keyring.verify[kid] = verifyKey{method, pub}
+	return kid, nil
+}
+
+// lookupKey finds the key for a token's kid, asking the JWKS when it is
+// not one of ours.
+func lookupKey(kid string) (verifyKey, bool) {
+	keyring.mu.RLock()
+	k, ok := keyring.verify[kid]
+	remote := keyring.remote
+	keyring.mu.RUnlock()
+
+	if !ok && remote != nil {
+		k, ok = remote.lookup(kid)
+	}
+	return k, ok
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	k := currentSigningKey()
+	t := jwt.NewWithClaims(k.method, claims)
+	t.Header["kid"] = k.kid
+	return t.SignedString(k.key)
+}
+
+func tokenKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+	k, ok := lookupKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return k.key, nil
+}
+
+// ---------------------------
+// key files
+// ---------------------------
+
+func methodFor(pub crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", pub)
+}
+
+// keyID derives the kid from the public key, so the signer and every
+// verifier agree on it without extra configuration.
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// readPEM takes either a path or the PEM text itself.
+func readPEM(v string) (*pem.Block, error) {
+	data := []byte(v)
+	if !strings.HasPrefix(strings.TrimSpace(v), "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(v); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return block, nil
+}
+
+func readPrivateKey(v string) (crypto.PrivateKey, error) {
+	block, err := readPEM(v)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+}
+
+// readPublicKey also accepts a private key and uses its public half.
+func readPublicKey(v string) (crypto.PublicKey, error) {
+	block, err := readPEM(v)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	priv, err := readPrivateKey(v)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key has no public half")
+	}
+	return signer.Public(), nil
+}
+
+// ---------------------------
+// JWKS
+// ---------------------------
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKSHandler serves GET /.well-known/jwks.json with every public key
+// that currently verifies.
+func JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyring.mu.RLock()
+		set := jwkSet{Keys: []jwk{}}
+		for kid, k := range keyring.verify {
+			set.Keys = append(set.Keys, toJWK(kid, k))
+		}
+		keyring.mu.RUnlock()
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, set)
+	}
+}
+
+func toJWK(kid string, k verifyKey) jwk {
+	j := jwk{Kid: kid, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.key.(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return j
+}
+
+func fromJWK(j jwk) (verifyKey, error) {
+	switch {
+	case j.Kty == "RSA" && (j.Alg == "RS256" || j.Alg == ""): // alg is optional in JWKS
+		n, err1 := base64.RawURLEncoding.DecodeString(j.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(j.E)
+		if err1 != nil || err2 != nil {
+			return verifyKey{}, errors.New("bad RSA key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verifyKey{jwt.SigningMethodRS256, pub}, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verifyKey{}, errors.New("bad Ed25519 key")
+		}
+		return verifyKey{jwt.SigningMethodEdDSA, ed25519.PublicKey(x)}, nil
+	}
+	return verifyKey{}, fmt.Errorf("unsupported key %s/%s", j.Kty, j.Alg)
+}
+
+type remoteKeys struct {
+	url       string
+	mu        sync.Mutex
+	keys      map[string]verifyKey
+	attempted time.Time // last fetch from lookup, whether it worked or not
+}
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// lookup finds kid, fetching the set again when it is unknown: that
+// usually means the issuer rotated. Fetches, failed ones included, are
+// at most one per jwksRefetchInterval and run outside the lock, so junk
+// kids or an unreachable issuer cost one request, not a queue of
+// callers waiting on it.
+func (r *remoteKeys) lookup(kid string) (verifyKey, bool) {
+	r.mu.Lock()
+	if k, ok := r.keys[kid]; ok {
+		r.mu.Unlock()
+		return k, true
+	}
+	if time.Since(r.attempted) < jwksRefetchInterval {
+		r.mu.Unlock()
+		return verifyKey{}, false
+	}
+	r.attempted = time.Now()
+	r.mu.Unlock()
+
+	if !r.refresh() {
+		return verifyKey{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[kid]
+	return k, ok
+}
+
+// refresh fetches the set once and keeps it if that worked.
+func (r *remoteKeys) refresh() bool {
+	keys, err := fetchJWKS(r.url)
+	if err != nil {
+		log.Println("JWKS fetch failed:", err)
+		return false
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return true
+}
+
+// warm fetches the set at startup. The API server may still be
+// starting, so it gets a few seconds.
+func (r *remoteKeys) warm() {
+	for attempt := 0; attempt < 5; attempt++ {
+		if r.refresh() {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func fetchJWKS(url string) (map[string]verifyKey, error) {
+	resp, err := jwksClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]verifyKey, len(set.Keys))
+	for _, j := range set.Keys {
+		k, err := fromJWK(j)
+		if err != nil {
+			log.Printf("JWKS: skipping key %s: %v", j.Kid, err)
+			continue
+		}
+		keys[j.Kid] = k
+	}
+	return keys, nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"mangahub/internal/audit"
+)
+
+// The IP rate limit does nothing against an attacker spread over many
+// addresses, so failed logins are also counted per username. After
+// lockoutThreshold failures in a row the account is locked, for twice
+// as long each further failure, up to lockoutMax. A successful login
+// resets the count, and so does a day without failures.
+//
+// Usernames that do not exist are counted the same way, so a lockout
+// does not tell anyone whether the account is real.
+
+const (
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = time.Hour
+	failureWindow    = 24 * time.Hour
+)
+
+// lockedFor returns how long username must wait before trying again.
+func lockedFor(db *sql.DB, username string) time.Duration {
+	var until sql.NullTime
+	db.QueryRow(`SELECT locked_until FROM login_failures WHERE username = ?`, username).Scan(&until)
+	if !until.Valid {
+		return 0
+	}
+	if wait := time.Until(until.Time); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// loginFailed counts a failed login and returns the lockout it caused,
+// if any.
+func loginFailed(db *sql.DB, username, ip string) time.Duration {
+	now := time.Now().UTC()
+
+	var failures int
+	var last sql.NullTime
+	db.QueryRow(`
+		SELECT failures, last_failed_at FROM login_failures WHERE username = ?
+	`, username).Scan(&failures, &last)
+	if last.Valid && now.Sub(last.Time) > failureWindow {
+		failures = 0
+	}
+	failures++
+
+	var lock time.Duration
+	var until sql.NullTime
+	if failures >= lockoutThreshold {
+		lock = lockoutBase << (failures - lockoutThreshold)
+		if lock > lockoutMax || lock <= 0 {
+			lock = lockoutMax
+		}
+		until = sql.NullTime{Time: now.Add(lock), Valid: true}
+	}
+
+	db.Exec(`
+		INSERT INTO login_failures (username, failures, last_failed_at, locked_until)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET
+			failures = excluded.failures,
+			last_failed_at = excluded.last_failed_at,
+			locked_until = excluded.locked_until
+	`, username, failures, now, until)
+
+	if lock > 0 {
+		audit.Record(db, audit.Entry{
+			Action:     "auth.lockout",
+			TargetType: "user",
+			TargetID:   username,
+			IP:         ip,
+			After: map[string]any{
+				"failures":     failures,
+				"locked_until": until.Time,
+			},
+		})
+	}
+
+	// forget usernames nobody has got wrong for a while
+	db.Exec(`DELETE FROM login_failures WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)`,
+		now.Add(-failureWindow), now)
+	return lock
+}
+
+func loginSucceeded(db *sql.DB, username string) {
+	db.Exec(`DELETE FROM login_failures WHERE username = ?`, username)
+}
+
+func lockedResponse(c *gin.Context, wait time.Duration) {
+	secs := int(wait.Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(429, gin.H{
+		"error":       "account temporarily locked after too many failed logins",
+		"retry_after": secs,
+	})
+}
+
+// dummyHash has the same cost as real password hashes. Its password is
+// not used anywhere.
+var dummyHash = []byte("$2a$10$x4kOu3ikMYhvjBSoTx8xgeCRozI1pM4SBtoJOJmcTmkHLp/KfE/kW")
+
+// checkPassword compares password with hash, or with dummyHash when the
+// user does not exist, so both cases take as long as a real check.
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
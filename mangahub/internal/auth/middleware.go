@@ -1,12 +1,15 @@
 package auth
 
 import (
+	"database/sql"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts an access token or, with db set, an API key.
+// API keys are limited to the routes their scopes cover.
+func AuthMiddleware(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if header == "" || !strings.HasPrefix(header, "Bearer ") {
@@ -16,16 +19,64 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := strings.TrimPrefix(header, "Bearer ")
-		claims, err := ParseAccessToken(token)
+		claims, err := Authenticate(db, token, c.ClientIP())
+		if err == ErrAPIKeyExpired {
+			c.JSON(401, gin.H{"error": "api key expired"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(401, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
-		c.Set("claims", claims)
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		if claims.APIKeyID != "" && !apiKeyAllows(claims, c.Request.Method, c.Request.URL.Path) {
+			c.JSON(403, gin.H{"error": "api key scope does not allow this request"})
+			c.Abort()
+			return
+		}
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth is AuthMiddleware for public routes: a valid credential
+// sets the same values, anything else leaves the request anonymous.
+func OptionalAuth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			claims, err := Authenticate(db, token, c.ClientIP())
+			if err == nil && (claims.APIKeyID == "" || apiKeyAllows(claims, c.Request.Method, c.Request.URL.Path)) {
+				setClaims(c, claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+func setClaims(c *gin.Context, claims *Claims) {
+	c.Set("claims", claims)
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("session_id", claims.SessionID)
+	c.Set("email_verified", claims.EmailVerified)
+	c.Set("api_key_id", claims.APIKeyID)
+}
+
+// RequireVerifiedEmail keeps accounts that have not verified an email
+// address away from community features. Runs after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			c.JSON(403, gin.H{
+				"error":              "verify your email address to use this feature",
+				"email_verification": "required",
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
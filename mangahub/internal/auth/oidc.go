@@ -0,0 +1,617 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// MangaHub can log users in through external OpenID Connect providers
+// with the authorization code flow and PKCE. Providers are listed in a
+// JSON file named by OIDC_PROVIDERS:
+//
+//	[{
+//	  "name": "google",
+//	  "display_name": "Google",
+//	  "issuer": "https://accounts.google.com",
+//	  "client_id": "...",
+//	  "client_secret_env": "GOOGLE_CLIENT_SECRET",
+//	  "scopes": ["openid", "email", "profile"],
+//	  "allow_signup": true
+//	}]
+//
+// Endpoints and keys come from the issuer's discovery document. The
+// redirect URI to register with a provider is
+// PUBLIC_URL/auth/oidc/<name>/callback.
+//
+// An external identity belongs to one local user. Logging in with an
+// identity nobody has linked creates a new account, except when an
+// account already has the same email address: its owner has to log in
+// and link the provider from their profile, so a provider that hands
+// out addresses it never checked cannot be used to take accounts over.
+//
+// The state of a flow is tied to the browser that started it by the
+// OIDC cookie, and the callback refuses a state that comes back in any
+// other browser. Otherwise someone could start a link to their own
+// account and have a victim finish it, or log a victim into theirs.
+
+const (
+	oidcLoginTTL     = 10 * time.Minute
+	oidcDiscoveryTTL = time.Hour
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown login provider")
+	ErrInvalidOIDCState = errors.New("login expired or already used, start again")
+	ErrOIDCOtherBrowser = errors.New("login was started in another browser, start again here")
+	ErrOIDCEmailInUse   = errors.New("an account with this email already exists, log in and link the provider from your profile")
+	ErrOIDCSignupClosed = errors.New("no account is linked to this identity")
+	ErrIdentityLinked   = errors.New("identity is linked to another account")
+	ErrProviderLinked   = errors.New("provider already linked, unlink it first")
+	ErrIdentityNotFound = errors.New("provider not linked")
+	ErrLastLogin        = errors.New("this is the only way to log in, set a password first")
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9-]{1,30}$`)
+
+// OIDCProvider is one entry of the providers file.
+type OIDCProvider struct {
+	Name            string   `json:"name"`
+	DisplayName     string   `json:"display_name"`
+	Issuer          string   `json:"issuer"`
+	ClientID        string   `json:"client_id"`
+	ClientSecret    string   `json:"client_secret"`
+	ClientSecretEnv string   `json:"client_secret_env"`
+	Scopes          []string `json:"scopes"`
+	AllowSignup     *bool    `json:"allow_signup"` // default true
+	Disabled        bool     `json:"disabled"`
+
+	mu         sync.Mutex
+	meta       *oidcMetadata
+	discovered time.Time
+	keys       *remoteKeys
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProviderInfo is what clients see of a provider.
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+var oidc struct {
+	providers map[string]*OIDCProvider
+	order     []string
+}
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// LoadOIDCProviders reads the providers file named by OIDC_PROVIDERS.
+// Without it external login is off.
+func LoadOIDCProviders() error {
+	path := os.Getenv("OIDC_PROVIDERS")
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []*OIDCProvider
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	providers := make(map[string]*OIDCProvider)
+	var order []string
+	for _, p := range list {
+		if p.Disabled {
+			continue
+		}
+		if !providerName.MatchString(p.Name) {
+			return fmt.Errorf("%s: provider name %q must be lowercase letters, digits or -", path, p.Name)
+		}
+		if providers[p.Name] != nil {
+			return fmt.Errorf("%s: provider %q listed twice", path, p.Name)
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("%s: provider %q needs issuer and client_id", path, p.Name)
+		}
+		p.Issuer = strings.TrimRight(p.Issuer, "/")
+		if p.ClientSecretEnv != "" {
+			p.ClientSecret = os.Getenv(p.ClientSecretEnv)
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = p.Name
+		}
+		providers[p.Name] = p
+		order = append(order, p.Name)
+	}
+
+	oidc.providers = providers
+	oidc.order = order
+	return nil
+}
+
+// OIDCProviders lists the enabled providers in file order.
+func OIDCProviders() []OIDCProviderInfo {
+	list := []OIDCProviderInfo{}
+	for _, name := range oidc.order {
+		p := oidc.providers[name]
+		list = append(list, OIDCProviderInfo{Name: p.Name, DisplayName: p.DisplayName})
+	}
+	return list
+}
+
+func (p *OIDCProvider) signupAllowed() bool {
+	return p.AllowSignup == nil || *p.AllowSignup
+}
+
+func (p *OIDCProvider) redirectURI() string {
+	return publicURL() + "/auth/oidc/" + p.Name + "/callback"
+}
+
+// discover fetches the provider's endpoints, at most once an hour.
+func (p *OIDCProvider) discover() (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil && time.Since(p.discovered) < oidcDiscoveryTTL {
+		return p.meta, nil
+	}
+
+	resp, err := oidcClient.Get(p.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("%s discovery: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s discovery: %s", p.Name, resp.Status)
+	}
+
+	var meta oidcMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("%s discovery: %w", p.Name, err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("%s discovery: issuer is %q, expected %q", p.Name, meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%s discovery: endpoints missing", p.Name)
+	}
+
+	if p.keys == nil || p.keys.url != meta.JWKSURI {
+		p.keys = &remoteKeys{url: meta.JWKSURI}
+	}
+	p.meta = &meta
+	p.discovered = time.Now()
+	return p.meta, nil
+}
+
+func lookupProvider(name string) (*OIDCProvider, error) {
+	p := oidc.providers[name]
+	if p == nil {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// ---------------------------
+// Authorization code flow
+// ---------------------------
+
+// BeginOIDC starts a login with provider and returns the URL to send
+// the user to, and the secret to keep in the browser's OIDC cookie
+// until the callback. With userID set the flow links the identity to
+// that user instead of logging in.
+func BeginOIDC(db *sql.DB, provider, userID, deviceName string) (authURL, browser string, err error) {
+	p, err := lookupProvider(provider)
+	if err != nil {
+		return "", "", err
+	}
+	meta, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, stateHash, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, _, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, _, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	browser, browserHash, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	db.Exec(`DELETE FROM oidc_logins WHERE expires_at < ?`, now)
+	_, err = db.Exec(`
+		INSERT INTO oidc_logins (state, provider, code_verifier, nonce, user_id, device_name, browser, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, stateHash, p.Name, verifier, nonce, userID, deviceName, browserHash, now.Add(oidcLoginTTL))
+	if err != nil {
+		return "", "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.redirectURI())
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), browser, nil
+}
+
+// OIDCResult says what a finished flow did.
+type OIDCResult struct {
+	UserID     string
+	DeviceName string
+	Linked     bool // the flow linked an identity to a logged in user
+	Created    bool // a new account was made for the identity
+}
+
+type idTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// FinishOIDC handles the provider's redirect back: it swaps the code
+// for an ID token, checks it, and logs in or links the identity.
+// browser is the OIDC cookie of the request, which has to be the one
+// BeginOIDC handed out for state.
+func FinishOIDC(db *sql.DB, provider, state, code, browser string) (*OIDCResult, error) {
+	p, err := lookupProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifier, nonce, userID, deviceName, browserHash string
+	stateHash := hashToken(state)
+	err = db.QueryRow(`
+		SELECT code_verifier, nonce, COALESCE(user_id, ''), COALESCE(device_name, ''), COALESCE(browser, '')
+		FROM oidc_logins WHERE state = ? AND provider = ? AND expires_at > ?
+	`, stateHash, p.Name, time.Now().UTC()).Scan(&verifier, &nonce, &userID, &deviceName, &browserHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if browser == "" || subtle.ConstantTimeCompare([]byte(hashToken(browser)), []byte(browserHash)) != 1 {
+		return nil, ErrOIDCOtherBrowser
+	}
+	// a state works once
+	if res, err := db.Exec(`DELETE FROM oidc_logins WHERE state = ?`, stateHash); err != nil {
+		return nil, err
+	} else if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	meta, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	rawID, err := p.exchangeCode(meta, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.verifyIDToken(rawID, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID != "" {
+		if err := linkIdentity(db, userID, p.Name, claims); err != nil {
+			return nil, err
+		}
+		return &OIDCResult{UserID: userID, Linked: true}, nil
+	}
+
+	result := &OIDCResult{DeviceName: deviceName}
+	err = db.QueryRow(`
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`, p.Name, claims.Subject).Scan(&result.UserID)
+	if err == nil {
+		db.Exec(`UPDATE user_identities SET email = ? WHERE provider = ? AND subject = ?`,
+			claims.Email, p.Name, claims.Subject)
+		return result, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if !p.signupAllowed() {
+		return nil, ErrOIDCSignupClosed
+	}
+	result.UserID, err = createOIDCUser(db, p.Name, claims)
+	if err != nil {
+		return nil, err
+	}
+	result.Created = true
+	return result, nil
+}
+
+func (p *OIDCProvider) exchangeCode(meta *oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI()},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID) // public client
+	}
+
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s token endpoint: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		if body.Error == "" {
+			body.Error = resp.Status
+		}
+		return "", fmt.Errorf("%s token endpoint: %s %s", p.Name, body.Error, body.ErrorDescription)
+	}
+	return body.IDToken, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(raw, nonce string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+	_, err := parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := p.keys.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("key %q is not for %s", kid, t.Method.Alg())
+		}
+		return k.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s id token: %w", p.Name, err)
+	}
+
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != p.Issuer:
+		return nil, fmt.Errorf("%s id token: wrong issuer", p.Name)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, fmt.Errorf("%s id token: wrong audience", p.Name)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%s id token: no expiry", p.Name)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%s id token: wrong nonce", p.Name)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%s id token: no subject", p.Name)
+	}
+	return &claims, nil
+}
+
+// ---------------------------
+// Linked identities
+// ---------------------------
+
+var usernameJunk = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// createOIDCUser makes an account for a new identity. It has no
+// password; the user can set one with a password reset.
+func createOIDCUser(db *sql.DB, provider string, claims *idTokenClaims) (string, error) {
+	var email sql.NullString
+	var verifiedAt sql.NullTime
+	if claims.Email != "" {
+		e, err := NormalizeEmail(claims.Email)
+		if err == nil {
+			var taken int
+			db.QueryRow(`SELECT COUNT(*) FROM users WHERE email = ?`, e).Scan(&taken)
+			if taken > 0 {
+				return "", ErrOIDCEmailInUse
+			}
+			email = sql.NullString{String: e, Valid: true}
+			if claims.EmailVerified {
+				verifiedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+			}
+		}
+	}
+
+	base := claims.PreferredUsername
+	if base == "" && email.Valid {
+		base = email.String[:strings.Index(email.String, "@")]
+	}
+	if base == "" {
+		base = claims.Name
+	}
+	base = usernameJunk.ReplaceAllString(base, "")
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// the preferred name, or the name with a number on it
+	username := base
+	var res sql.Result
+	for attempt := 0; attempt < 10; attempt++ {
+		res, err = tx.Exec(`
+			INSERT INTO users (username, password_hash, role, email, email_verified_at)
+			VALUES (?, '', 'user', ?, ?)
+		`, username, email, verifiedAt)
+		if err == nil || isUniqueEmailErr(err) {
+			break
+		}
+		n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+		username = fmt.Sprintf("%s%04d", base, n.Int64())
+	}
+	if isUniqueEmailErr(err) {
+		return "", ErrOIDCEmailInUse
+	}
+	if err != nil {
+		return "", err
+	}
+
+	id, _ := res.LastInsertId()
+	userID := fmt.Sprintf("%d", id)
+	if _, err := tx.Exec(`
+		INSERT INTO user_identities (provider, subject, user_id, email, linked_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, provider, claims.Subject, userID, claims.Email, time.Now().UTC()); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
+
+func linkIdentity(db *sql.DB, userID, provider string, claims *idTokenClaims) error {
+	var owner string
+	err := db.QueryRow(`
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`, provider, claims.Subject).Scan(&owner)
+	switch {
+	case err == nil && owner != userID:
+		return ErrIdentityLinked
+	case err == nil:
+		return nil // linked already
+	case err != sql.ErrNoRows:
+		return err
+	}
+
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider).Scan(&n)
+	if n > 0 {
+		return ErrProviderLinked
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO user_identities (provider, subject, user_id, email, linked_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, provider, claims.Subject, userID, claims.Email, time.Now().UTC())
+	return err
+}
+
+// Identity is a provider account linked to a user.
+type Identity struct {
+	Provider    string    `json:"provider"`
+	DisplayName string    `json:"display_name"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	LinkedAt    time.Time `json:"linked_at"`
+}
+
+// ListIdentities returns the providers linked to the user.
+func ListIdentities(db *sql.DB, userID string) ([]Identity, error) {
+	rows, err := db.Query(`
+		SELECT provider, subject, COALESCE(email, ''), linked_at
+		FROM user_identities WHERE user_id = ?
+		ORDER BY linked_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, &i.LinkedAt); err != nil {
+			return nil, err
+		}
+		i.DisplayName = i.Provider
+		if p := oidc.providers[i.Provider]; p != nil {
+			i.DisplayName = p.DisplayName
+		}
+		list = append(list, i)
+	}
+	return list, rows.Err()
+}
+
+// UnlinkIdentity removes a provider from the user, unless the user
+// would be left without any way to log in.
+func UnlinkIdentity(db *sql.DB, userID, provider string) error {
+	var hash string
+	if err := db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&hash); err != nil {
+		return err
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = ?`, userID).Scan(&n)
+
+	var linked int
+	db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider).Scan(&linked)
+	if linked == 0 {
+		return ErrIdentityNotFound
+	}
+	if hash == "" && n <= 1 {
+		return ErrLastLogin
+	}
+
+	_, err := db.Exec(`DELETE FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+	return err
+}
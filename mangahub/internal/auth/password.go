@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 6
+
+var (
+	ErrWrongPassword = errors.New("wrong password")
+	ErrWeakPassword  = errors.New("password too short")
+)
+
+// ChangePassword checks oldPassword, stores newPassword and revokes
+// every refresh token of the user, so other devices must log in again.
+func ChangePassword(db *sql.DB, userID, oldPassword, newPassword string) error {
+	var hash string
+	err := db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&hash)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(oldPassword)) != nil {
+		return ErrWrongPassword
+	}
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, newHash, userID); err != nil {
+		return err
+	}
+	return RevokeAllSessions(db, userID)
+}
@@ -1,82 +1,25 @@
 package auth
 
 import (
+	"database/sql"
 	"net/http"
-	"sync"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-)
-
-type rateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.Mutex
-	limit    int           // max requests
-	window   time.Duration // time window
-}
-
-var limiter = &rateLimiter{
-	requests: make(map[string][]time.Time),
-	limit:    100,             // 100 requests
-	window:   1 * time.Minute, // per minute
-}
-
-// cleanup old entries periodically
-func init() {
-	go func() {
-		for {
-			time.Sleep(5 * time.Minute)
-			limiter.mu.Lock()
-			now := time.Now()
-			for ip, times := range limiter.requests {
-				var valid []time.Time
-				for _, t := range times {
-					if now.Sub(t) < limiter.window {
-						valid = append(valid, t)
-					}
-				}
-				if len(valid) == 0 {
-					delete(limiter.requests, ip)
-				} else {
-					limiter.requests[ip] = valid
-				}
-			}
-			limiter.mu.Unlock()
-		}
-	}()
-}
-
-func (r *rateLimiter) isAllowed(ip string) bool {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-r.window)
-
-	// Filter requests within the window
-	var valid []time.Time
-	for _, t := range r.requests[ip] {
-		if t.After(windowStart) {
-			valid = append(valid, t)
-		}
-	}
-
-	if len(valid) >= r.limit {
-		r.requests[ip] = valid
-		return false
-	}
 
-	// Add current request
-	r.requests[ip] = append(valid, now)
-	return true
-}
+	"mangahub/internal/ratelimit"
+)
 
-// RateLimitMiddleware limits requests per IP
-func RateLimitMiddleware() gin.HandlerFunc {
+// RateLimitMiddleware applies g to every request. It runs before
+// AuthMiddleware, so it tells callers apart on its own: by API key,
+// then by the user in the access token, then by IP. A bad credential
+// counts against the IP; AuthMiddleware rejects it later.
+func RateLimitMiddleware(db *sql.DB, g *ratelimit.Guard) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
+		r := g.Allow(rateLimitSubject(db, c), c.Request.Method+" "+c.Request.URL.Path)
+		r.SetHeaders(c.Writer.Header())
 
-		if !limiter.isAllowed(ip) {
+		if !r.Allowed {
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "rate limit exceeded, try again later",
 			})
@@ -88,26 +31,25 @@ func RateLimitMiddleware() gin.HandlerFunc {
 	}
 }
 
-// StrictRateLimitMiddleware for sensitive endpoints (login, register)
-// 10 requests per minute
-func StrictRateLimitMiddleware() gin.HandlerFunc {
-	strictLimiter := &rateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    10,
-		window:   1 * time.Minute,
+func rateLimitSubject(db *sql.DB, c *gin.Context) ratelimit.Subject {
+	credential, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ratelimit.IP(c.ClientIP())
 	}
-
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-
-		if !strictLimiter.isAllowed(ip) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "too many attempts, try again later",
-			})
-			c.Abort()
-			return
+	if strings.HasPrefix(credential, APIKeyPrefix) {
+		if id := apiKeyID(db, credential); id != "" {
+			return ratelimit.APIKey(id)
 		}
-
-		c.Next()
+	} else if claims, err := ParseAccessToken(credential); err == nil && claims.UserID != "" {
+		return ratelimit.User(claims.UserID)
 	}
+	return ratelimit.IP(c.ClientIP())
+}
+
+// apiKeyID returns the id of key, or "" for unknown keys. It does not
+// check expiry or suspension, that is AuthenticateAPIKey's job.
+func apiKeyID(db *sql.DB, key string) string {
+	var id string
+	db.QueryRow(`SELECT id FROM api_keys WHERE key_hash = ?`, hashToken(key)).Scan(&id)
+	return id
 }
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	// staff roles created on first start; their permissions can be
+	// changed through the admin API
+	RoleModerator = "moderator"
+	RoleEditor    = "editor"
+	RoleUploader  = "uploader"
+
+	// RoleService is for our own servers talking to each other. It is
+	// never stored on a user.
+	RoleService = "service"
+)
+
+// Permissions name what a role may do. Admins have all of them, plain
+// users none; every other role gets a list, stored in the roles table.
+const (
+	PermMangaWrite     = "manga:write"
+	PermChapterUpload  = "chapter:upload"
+	PermReviewModerate = "review:moderate"
+	PermUserBan        = "user:ban"
+)
+
+var AllPermissions = []string{PermMangaWrite, PermChapterUpload, PermReviewModerate, PermUserBan}
+
+var defaultRoles = map[string][]string{
+	RoleModerator: {PermReviewModerate, PermUserBan},
+	RoleEditor:    {PermMangaWrite, PermChapterUpload},
+	RoleUploader:  {PermChapterUpload},
+}
+
+var (
+	ErrFixedRole   = errors.New("this role cannot be changed")
+	ErrDefaultRole = errors.New("default roles cannot be deleted")
+	ErrRoleInUse   = errors.New("role is still given to users")
+	ErrRoleName    = errors.New("role names are 2 to 30 lowercase letters, digits or -")
+	ErrUnknownPerm = errors.New("unknown permission")
+	ErrRoleMissing = errors.New("role not found")
+)
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9-]{1,29}$`)
+
+func ValidPermission(p string) bool {
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedRole reports whether role is built into the code rather than
+// stored in the roles table.
+func fixedRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleService
+}
+
+// EnsureDefaultRoles creates the default staff roles that are missing.
+// Changes made to them later are kept.
+func EnsureDefaultRoles(db *sql.DB) error {
+	for name, perms := range defaultRoles {
+		if _, err := db.Exec(`
+			INSERT OR IGNORE INTO roles (name, permissions) VALUES (?, ?)
+		`, name, strings.Join(perms, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidRole reports whether role can be given to a user.
+func ValidRole(db *sql.DB, role string) bool {
+	if role == RoleUser || role == RoleAdmin {
+		return true
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM roles WHERE name = ?`, role).Scan(&n)
+	return n > 0
+}
+
+// RolePermissions returns what role may do.
+func RolePermissions(db *sql.DB, role string) []string {
+	switch role {
+	case RoleAdmin:
+		return AllPermissions
+	case RoleUser, RoleService:
+		return nil
+	}
+	var perms string
+	db.QueryRow(`SELECT permissions FROM roles WHERE name = ?`, role).Scan(&perms)
+	return splitPermissions(perms)
+}
+
+func splitPermissions(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// Can reports whether the claims carry perm. Admins can do everything,
+// including permissions added after their token was issued.
+func (c *Claims) Can(perm string) bool {
+	if c.Role == RoleAdmin {
+		return true
+	}
+	for _, p := range c.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Role is a role as the admin API shows it.
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	Fixed       bool     `json:"fixed"`   // user and admin
+	Default     bool     `json:"default"` // can be changed, not deleted
+	Users       int      `json:"users"`
+}
+
+// ListRoles returns every role that can be given to users.
+func ListRoles(db *sql.DB) ([]Role, error) {
+	counts := map[string]int{}
+	rows, err := db.Query(`SELECT COALESCE(role, 'user'), COUNT(*) FROM users GROUP BY COALESCE(role, 'user')`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r string
+		var n int
+		if err := rows.Scan(&r, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts[r] = n
+	}
+	rows.Close()
+
+	list := []Role{
+		{Name: RoleUser, Permissions: []string{}, Fixed: true, Users: counts[RoleUser]},
+		{Name: RoleAdmin, Permissions: AllPermissions, Fixed: true, Users: counts[RoleAdmin]},
+	}
+
+	rows, err = db.Query(`SELECT name, permissions FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Role
+		var perms string
+		if err := rows.Scan(&r.Name, &perms); err != nil {
+			return nil, err
+		}
+		r.Permissions = splitPermissions(perms)
+		if r.Permissions == nil {
+			r.Permissions = []string{}
+		}
+		_, r.Default = defaultRoles[r.Name]
+		r.Users = counts[r.Name]
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// SaveRole creates a role or replaces its permissions. Users with the
+// role get the new permissions with their next access token.
+func SaveRole(db *sql.DB, name string, perms []string) error {
+	if fixedRole(name) {
+		return ErrFixedRole
+	}
+	if !roleName.MatchString(name) {
+		return ErrRoleName
+	}
+	for _, p := range perms {
+		if !ValidPermission(p) {
+			return ErrUnknownPerm
+		}
+	}
+	_, err := db.Exec(`
+		INSERT INTO roles (name, permissions) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET permissions = excluded.permissions
+	`, name, strings.Join(dedupe(perms), ","))
+	return err
+}
+
+// DeleteRole removes a role nobody has anymore.
+func DeleteRole(db *sql.DB, name string) error {
+	if fixedRole(name) {
+		return ErrFixedRole
+	}
+	if _, ok := defaultRoles[name]; ok {
+		return ErrDefaultRole
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, name).Scan(&n)
+	if n > 0 {
+		return ErrRoleInUse
+	}
+
+	res, err := db.Exec(`DELETE FROM roles WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleMissing
+	}
+	db.Exec(`DELETE FROM role_policies WHERE role = ?`, name)
+	return nil
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxDeviceName = 64
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Device describes where a login came from.
+type Device struct {
+	Name      string
+	IP        string
+	UserAgent string
+}
+
+// DeviceFromRequest reads the client's IP and user agent. name is what
+// the client called itself; without one it is guessed from the agent.
+func DeviceFromRequest(c *gin.Context, name string) Device {
+	ua := c.Request.UserAgent()
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = guessDevice(ua)
+	}
+	if len(name) > maxDeviceName {
+		name = name[:maxDeviceName]
+	}
+	return Device{Name: name, IP: c.ClientIP(), UserAgent: ua}
+}
+
+func guessDevice(ua string) string {
+	var browser string
+	switch {
+	case ua == "":
+		return "Unknown device"
+	case strings.HasPrefix(ua, "Go-http-client"):
+		return "MangaHub CLI"
+	case strings.HasPrefix(ua, "curl/"):
+		return "curl"
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	default:
+		return "Unknown device"
+	}
+
+	for _, platform := range []struct{ marker, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, platform.marker) {
+			return browser + " on " + platform.name
+		}
+	}
+	return browser
+}
+
+// Session is one login, kept alive by rotating refresh tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// CreateSession starts a session for a fresh login and returns its id
+// and first refresh token.
+func CreateSession(db *sql.DB, userID string, dev Device) (sessionID, refresh string, err error) {
+	now := time.Now()
+
+	// expired tokens are only kept around for reuse detection
+	_, _ = db.Exec(`
+		DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?
+	`, userID, now)
+	_, _ = db.Exec(`
+		DELETE FROM sessions
+		WHERE user_id = ? AND id NOT IN (SELECT family_id FROM refresh_tokens WHERE user_id = ?)
+	`, userID, userID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	sessionID = uuid.NewString()
+	if _, err := tx.Exec(`
+		INSERT INTO sessions (id, user_id, device_name, ip, user_agent, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, sessionID, userID, dev.Name, dev.IP, dev.UserAgent, now, now); err != nil {
+		return "", "", err
+	}
+
+	refresh, err = insertRefreshToken(tx, userID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID, refresh, tx.Commit()
+}
+
+// ListSessions returns the user's sessions, most recently used first.
+// currentID marks the session the request came from.
+func ListSessions(db *sql.DB, userID, currentID string) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(device_name, ''), COALESCE(ip, ''), COALESCE(user_agent, ''),
+		       created_at, last_used_at
+		FROM sessions
+		WHERE user_id = ?
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.DeviceName, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == currentID
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// RevokeSession ends one of the user's sessions.
+func RevokeSession(db *sql.DB, userID, sessionID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+	if err := deleteSession(tx, sessionID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	sessionRevoked(userID, sessionID)
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user except keepID and
+// returns how many were ended.
+func RevokeOtherSessions(db *sql.DB, userID, keepID string) (int, error) {
+	rows, err := db.Query(`SELECT id FROM sessions WHERE user_id = ? AND id != ?`, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := RevokeSession(db, userID, id); err != nil && err != ErrSessionNotFound {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// RevokeAllSessions logs the user out everywhere.
+func RevokeAllSessions(db *sql.DB, userID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	sessionRevoked(userID, "")
+	return nil
+}
+
+func deleteSession(tx *sql.Tx, sessionID string) error {
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE family_id = ?`, sessionID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID)
+	return err
+}
+
+var (
+	revokeHooksMu sync.Mutex
+	revokeHooks   []func(userID, sessionID string)
+)
+
+// OnSessionRevoked registers fn to run after a session ends, so live
+// TCP and UDP channels opened with it can be dropped. An empty
+// sessionID means every session of the user.
+func OnSessionRevoked(fn func(userID, sessionID string)) {
+	revokeHooksMu.Lock()
+	revokeHooks = append(revokeHooks, fn)
+	revokeHooksMu.Unlock()
+}
+
+func sessionRevoked(userID, sessionID string) {
+	revokeHooksMu.Lock()
+	hooks := append([]func(string, string){}, revokeHooks...)
+	revokeHooksMu.Unlock()
+
+	for _, fn := range hooks {
+		fn(userID, sessionID)
+	}
+}
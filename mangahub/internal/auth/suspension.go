@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Suspension is an active ban. A zero Until means it has no end.
+type Suspension struct {
+	Reason string     `json:"reason"`
+	Since  time.Time  `json:"since"`
+	Until  *time.Time `json:"until"`
+	By     string     `json:"by"`
+}
+
+// ActiveSuspension returns the user's current suspension, or nil when
+// they are not suspended (or it has run out).
+func ActiveSuspension(db *sql.DB, userID string) (*Suspension, error) {
+	var since, until sql.NullTime
+	var reason, by sql.NullString
+
+	err := db.QueryRow(`
+		SELECT suspended_at, suspended_until, suspension_reason, suspended_by
+		FROM users WHERE id = ?
+	`, userID).Scan(&since, &until, &reason, &by)
+	if err != nil {
+		return nil, err
+	}
+	return SuspensionFromColumns(since, until, reason, by), nil
+}
+
+// SuspensionFromColumns builds a Suspension from the suspended_*
+// columns of users, or nil when it is not in force.
+func SuspensionFromColumns(since, until sql.NullTime, reason, by sql.NullString) *Suspension {
+	if !since.Valid {
+		return nil
+	}
+	if until.Valid && time.Now().After(until.Time) {
+		return nil
+	}
+
+	s := &Suspension{Reason: reason.String, Since: since.Time, By: by.String}
+	if until.Valid {
+		s.Until = &until.Time
+	}
+	return s
+}
+
+// Suspend bans a user until the given time (nil for indefinitely) and
+// logs them out everywhere.
+func Suspend(db *sql.DB, userID, reason string, until *time.Time, by string) error {
+	var end sql.NullTime
+	if until != nil {
+		end = sql.NullTime{Time: until.UTC(), Valid: true}
+	}
+
+	_, err := db.Exec(`
+		UPDATE users
+		SET suspended_at = ?, suspended_until = ?, suspension_reason = ?, suspended_by = ?
+		WHERE id = ?
+	`, time.Now().UTC(), end, reason, by, userID)
+	if err != nil {
+		return err
+	}
+	return RevokeAllSessions(db, userID)
+}
+
+// Unsuspend lifts a suspension.
+func Unsuspend(db *sql.DB, userID string) error {
+	_, err := db.Exec(`
+		UPDATE users
+		SET suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL, suspended_by = NULL
+		WHERE id = ?
+	`, userID)
+	return err
+}
+
+func suspendedResponse(s *Suspension) map[string]any {
+	res := map[string]any{
+		"error":  "account suspended",
+		"reason": s.Reason,
+	}
+	if s.Until != nil {
+		res["until"] = s.Until.UTC().Format(time.RFC3339)
+	}
+	return res
+}
@@ -1,86 +1,242 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/google/uuid"
+
+	"mangahub/internal/audit"
 )
 
 var (
-	jwtSecret       = []byte("supersecretkey")
 	accessTokenTTL  = 1 * time.Minute
 	refreshTokenTTL = 7 * 24 * time.Hour
 )
 
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID        string `json:"user_id"`
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	SessionID     string `json:"sid,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+
+	// what the role allows, as of when the token was issued
+	Permissions []string `json:"perms,omitempty"`
+
+	// set for API key requests only, never part of a token
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
+
 	jwt.RegisteredClaims
 }
 
-func CreateAccessToken(userID, username, role string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(jwtSecret)
+func CreateAccessToken(userID, username, role, sessionID string) (string, error) {
+	return signAccessToken(&Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+	})
+}
+
+// AccessTokenFor signs an access token with the user's current role,
+// its permissions and the verification state from the database.
+func AccessTokenFor(db *sql.DB, userID, sessionID string) (string, error) {
+	var username, role string
+	var verified sql.NullTime
+	err := db.QueryRow(`
+		SELECT username, COALESCE(role, 'user'), email_verified_at FROM users WHERE id = ?
+	`, userID).Scan(&username, &role, &verified)
+	if err != nil {
+		return "", err
+	}
+	return signAccessToken(&Claims{
+		UserID:        userID,
+		Username:      username,
+		Role:          role,
+		SessionID:     sessionID,
+		EmailVerified: verified.Valid,
+		Permissions:   RolePermissions(db, role),
+	})
+}
+
+func signAccessToken(claims *Claims) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return signToken(claims)
+}
+
+// CreateServiceToken identifies one of our own processes, for example
+// the API server when it tells the TCP server to drop a session.
+func CreateServiceToken(name string) (string, error) {
+	return CreateAccessToken("", name, RoleService, "")
+}
+
+// Refresh tokens are opaque random strings. Only their SHA-256 is
+// stored, so a leaked database does not leak usable tokens.
+//
+// Every login starts a token family, which is what users see as a
+// session (see session.go). Each refresh marks the presented
+// token used and hands out the next one in the same family. Presenting
+// a token that was already used means it was copied somewhere, so the
+// whole family is revoked and both the thief and the owner must log in
+// again.
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// newOpaqueToken makes a random token and the hash to store for it.
+// Also used for login challenges.
+func newOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
 }
 
-func CreateRefreshToken(db *sql.DB, userID string) (string, error) {
-	token := uuid.NewString()
-	expires := time.Now().Add(refreshTokenTTL)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	_, err := db.Exec(`
-		INSERT INTO refresh_tokens (token, user_id, expires_at)
-		VALUES (?, ?, ?)
-	`, token, userID, expires)
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertRefreshToken(db execer, userID, familyID string) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
 
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (token, user_id, family_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hash, userID, familyID, time.Now().Add(refreshTokenTTL), time.Now())
 	return token, err
 }
 
-func ValidateRefreshToken(db *sql.DB, token string) (string, error) {
-	var userID string
-	var expiresAt time.Time
+// RotateRefreshToken exchanges a refresh token for the next one of its
+// family and returns the owner and session. A token that was already
+// exchanged revokes the session and returns ErrRefreshTokenReused.
+func RotateRefreshToken(db *sql.DB, token, ip string) (userID, sessionID, next string, err error) {
+	hash := hashToken(token)
 
-	err := db.QueryRow(`
-		SELECT user_id, expires_at
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", "", err
+	}
+	defer tx.Rollback()
+
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT user_id, family_id, expires_at, used_at
 		FROM refresh_tokens
 		WHERE token = ?
-	`, token).Scan(&userID, &expiresAt)
+	`, hash).Scan(&userID, &sessionID, &expiresAt, &usedAt)
 
 	if err == sql.ErrNoRows {
-		return "", errors.New("invalid refresh token")
+		return "", "", "", ErrInvalidRefreshToken
 	}
 	if err != nil {
-		return "", err
+		return "", "", "", err
+	}
+
+	if usedAt.Valid {
+		if err := deleteSession(tx, sessionID); err != nil {
+			return "", "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", "", "", err
+		}
+		log.Printf("auth: refresh token reused, revoked session %s of user %s", sessionID, userID)
+		audit.Record(db, audit.Entry{
+			ActorID:    userID,
+			Action:     "session.reuse_revoked",
+			TargetType: "session",
+			TargetID:   sessionID,
+			IP:         ip,
+		})
+		sessionRevoked(userID, sessionID)
+		return "", "", "", ErrRefreshTokenReused
 	}
+
 	if time.Now().After(expiresAt) {
-		_ = RevokeRefreshToken(db, token)
-		return "", errors.New("refresh token expired")
+		if err := deleteSession(tx, sessionID); err != nil {
+			return "", "", "", err
+		}
+		tx.Commit()
+		sessionRevoked(userID, sessionID)
+		return "", "", "", ErrRefreshTokenExpired
+	}
+
+	// the used_at guard makes two concurrent refreshes with the same
+	// token count as reuse instead of forking the family
+	res, err := tx.Exec(`
+		UPDATE refresh_tokens SET used_at = ? WHERE token = ? AND used_at IS NULL
+	`, time.Now(), hash)
+	if err != nil {
+		return "", "", "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", "", "", ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE sessions SET last_used_at = ?, ip = ? WHERE id = ?
+	`, time.Now(), ip, sessionID); err != nil {
+		return "", "", "", err
+	}
+
+	next, err = insertRefreshToken(tx, userID, sessionID)
+	if err != nil {
+		return "", "", "", err
 	}
+	return userID, sessionID, next, tx.Commit()
+}
 
-	return userID, nil
+// refreshTokenOwner returns who a refresh token belongs to, or empty
+// strings for unknown tokens.
+func refreshTokenOwner(db *sql.DB, token string) (userID, sessionID string) {
+	db.QueryRow(`
+		SELECT user_id, family_id FROM refresh_tokens WHERE token = ?
+	`, hashToken(token)).Scan(&userID, &sessionID)
+	return userID, sessionID
 }
 
+// RevokeRefreshToken ends the session the token belongs to, including
+// every token rotated from the same login.
 func RevokeRefreshToken(db *sql.DB, token string) error {
-	_, err := db.Exec(`DELETE FROM refresh_tokens WHERE token = ?`, token)
-	return err
+	var userID, sessionID string
+	err := db.QueryRow(`
+		SELECT user_id, family_id FROM refresh_tokens WHERE token = ?
+	`, hashToken(token)).Scan(&userID, &sessionID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeSession(db, userID, sessionID)
 }
 
 func ParseAccessToken(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, tokenKey)
 	if err != nil {
 		return nil, err
 	}
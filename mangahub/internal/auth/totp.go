@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication with TOTP (RFC 6238): SHA-1, six digits,
+// 30 second steps, which is what every authenticator app expects.
+//
+// Enrolling keeps the new secret pending until the user proves their
+// app has it by sending a code. Only then is 2FA switched on and a set
+// of one-time recovery codes handed out.
+
+const (
+	totpIssuer        = "MangaHub"
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // steps either side of now that are still accepted
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTOTPEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnabled = errors.New("two-factor authentication not enabled")
+	ErrTOTPNotPending = errors.New("no two-factor enrollment in progress")
+	ErrTOTPRequired   = errors.New("two-factor authentication is required for this role")
+	ErrInvalidCode    = errors.New("invalid code")
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1000000)
+}
+
+// matchTOTP returns the step a code belongs to. Steps up to lastStep
+// were already used, so a code cannot be replayed.
+func matchTOTP(secret, code string, lastStep int64) (int64, bool) {
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	now := time.Now().Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func otpauthURI(username, secret string) string {
+	q := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+username) + "?" + q.Encode()
+}
+
+// TwoFactor is what users see about their own 2FA.
+type TwoFactor struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	Required          bool       `json:"required"` // by their role
+}
+
+func GetTwoFactor(db *sql.DB, userID string) (*TwoFactor, error) {
+	var enabledAt sql.NullTime
+	var role string
+	err := db.QueryRow(`
+		SELECT totp_enabled_at, COALESCE(role, 'user') FROM users WHERE id = ?
+	`, userID).Scan(&enabledAt, &role)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &TwoFactor{Enabled: enabledAt.Valid, Required: TOTPRequired(db, role)}
+	if enabledAt.Valid {
+		tf.EnabledAt = &enabledAt.Time
+		db.QueryRow(`
+			SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL
+		`, userID).Scan(&tf.RecoveryCodesLeft)
+	}
+	return tf, nil
+}
+
+// BeginTOTPEnrollment makes a new secret and returns it with the
+// otpauth:// URI for authenticator apps. Starting again replaces the
+// pending secret.
+func BeginTOTPEnrollment(db *sql.DB, userID string) (secret, uri string, err error) {
+	var username string
+	var enabledAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT username, totp_enabled_at FROM users WHERE id = ?
+	`, userID).Scan(&username, &enabledAt)
+	if err != nil {
+		return "", "", err
+	}
+	if enabledAt.Valid {
+		return "", "", ErrTOTPEnabled
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret = b32.EncodeToString(key)
+
+	if _, err := db.Exec(`UPDATE users SET totp_pending_secret = ? WHERE id = ?`, secret, userID); err != nil {
+		return "", "", err
+	}
+	return secret, otpauthURI(username, secret), nil
+}
+
+// ConfirmTOTPEnrollment switches 2FA on once code matches the pending
+// secret, and returns the recovery codes. They are only shown now.
+func ConfirmTOTPEnrollment(db *sql.DB, userID, code string) ([]string, error) {
+	var pending sql.NullString
+	err := db.QueryRow(`SELECT totp_pending_secret FROM users WHERE id = ?`, userID).Scan(&pending)
+	if err != nil {
+		return nil, err
+	}
+	if !pending.Valid {
+		return nil, ErrTOTPNotPending
+	}
+	step, ok := matchTOTP(pending.String, normalizeCode(code), 0)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users
+		SET totp_secret = totp_pending_secret, totp_pending_secret = NULL,
+		    totp_enabled_at = ?, totp_last_step = ?
+		WHERE id = ?
+	`, time.Now().UTC(), step, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused
+// recovery code, which is then used up.
+func VerifySecondFactor(db *sql.DB, userID, code string) error {
+	code = normalizeCode(code)
+
+	var secret sql.NullString
+	var lastStep int64
+	err := db.QueryRow(`
+		SELECT totp_secret, COALESCE(totp_last_step, 0) FROM users WHERE id = ?
+	`, userID).Scan(&secret, &lastStep)
+	if err != nil {
+		return err
+	}
+	if !secret.Valid {
+		return ErrTOTPNotEnabled
+	}
+
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(secret.String, code, lastStep)
+		if !ok {
+			return ErrInvalidCode
+		}
+		// the step check also stops two requests racing with one code
+		res, err := db.Exec(`
+			UPDATE users SET totp_last_step = ?
+			WHERE id = ? AND COALESCE(totp_last_step, 0) < ?
+		`, step, userID, step)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	res, err := db.Exec(`
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now().UTC(), userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// DisableTOTP switches 2FA off after checking a code. Users whose role
+// requires 2FA cannot turn it off.
+func DisableTOTP(db *sql.DB, userID, code string) error {
+	var role string
+	if err := db.QueryRow(`SELECT COALESCE(role, 'user') FROM users WHERE id = ?`, userID).Scan(&role); err != nil {
+		return err
+	}
+	if TOTPRequired(db, role) {
+		return ErrTOTPRequired
+	}
+	if err := VerifySecondFactor(db, userID, code); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users
+		SET totp_secret = NULL, totp_pending_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = ?
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes throws away the old recovery codes and makes
+// a new set, after checking a code.
+func RegenerateRecoveryCodes(db *sql.DB, userID, code string) ([]string, error) {
+	if err := VerifySecondFactor(db, userID, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// Recovery codes look like "k3jd9-x8w2m". Only their hash is kept.
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(b32.EncodeToString(b))
+		if _, err := tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, userID, hashToken(raw)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
+
+// normalizeCode forgives spaces, dashes and capitals, which people add
+// when typing codes from their phone or a printout.
+func normalizeCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// ---------------------------
+// role policy
+// ---------------------------
+
+// TOTPRequired reports whether users with role must use 2FA. Checked
+// at login, so it applies to each user from their next login.
+func TOTPRequired(db *sql.DB, role string) bool {
+	var required bool
+	db.QueryRow(`SELECT require_2fa FROM role_policies WHERE role = ?`, role).Scan(&required)
+	return required
+}
+
+func SetTOTPRequired(db *sql.DB, role string, required bool) error {
+	_, err := db.Exec(`
+		INSERT INTO role_policies (role, require_2fa) VALUES (?, ?)
+		ON CONFLICT(role) DO UPDATE SET require_2fa = excluded.require_2fa
+	`, role, required)
+	return err
+}
+
+// TOTPRequiredRoles lists the roles that must use 2FA.
+func TOTPRequiredRoles(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT role FROM role_policies WHERE require_2fa = 1 ORDER BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var r string
+		if err := rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// ---------------------------
+// login challenges
+// ---------------------------
+
+// A login challenge is handed out instead of tokens when the password
+// was right but a second factor is still needed. It is good for a few
+// minutes and a few wrong codes.
+
+const (
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var ErrInvalidChallenge = errors.New("invalid or expired challenge")
+
+type loginChallenge struct {
+	userID     string
+	deviceName string
+}
+
+func newChallenge(db *sql.DB, userID, deviceName string) (string, error) {
+	db.Exec(`DELETE FROM login_challenges WHERE expires_at < ?`, time.Now().UTC())
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+		INSERT INTO login_challenges (token, user_id, device_name, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, hash, userID, deviceName, time.Now().UTC().Add(challengeTTL))
+	return token, err
+}
+
+func loadChallenge(db *sql.DB, token string) (*loginChallenge, error) {
+	var ch loginChallenge
+	var device sql.NullString
+	err := db.QueryRow(`
+		SELECT user_id, device_name FROM login_challenges
+		WHERE token = ? AND expires_at > ? AND attempts < ?
+	`, hashToken(token), time.Now().UTC(), maxChallengeAttempts).Scan(&ch.userID, &device)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	ch.deviceName = device.String
+	return &ch, nil
+}
+
+func challengeFailed(db *sql.DB, token string) {
+	db.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token = ?`, hashToken(token))
+}
+
+func deleteChallenge(db *sql.DB, token string) {
+	db.Exec(`DELETE FROM login_challenges WHERE token = ?`, hashToken(token))
+}
+
+// secondFactorNeeded reports whether a login must go through a
+// challenge, and whether the user first has to enroll because their
+// role requires 2FA.
+func secondFactorNeeded(db *sql.DB, userID, role string) (needed, enroll bool) {
+	if totpEnabled(db, userID) {
+		return true, false
+	}
+	if TOTPRequired(db, role) {
+		return true, true
+	}
+	return false, false
+}
+
+func totpEnabled(db *sql.DB, userID string) bool {
+	var enabledAt sql.NullTime
+	db.QueryRow(`SELECT totp_enabled_at FROM users WHERE id = ?`, userID).Scan(&enabledAt)
+	return enabledAt.Valid
+}
@@ -0,0 +1,252 @@
+package collection
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Collection visibilities.
+const (
+	Public  = "public"
+	Private = "private"
+)
+
+const maxNameLength = 100
+
+var ErrNotFound = errors.New("collection not found")
+
+// Collection is a named, ordered reading list owned by one user.
+type Collection struct {
+	ID          int64  `json:"id"`
+	Slug        string `json:"slug"`
+	UserID      string `json:"user_id"`
+	Owner       string `json:"owner"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+	ItemCount   int    `json:"item_count"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Items       []Item `json:"items,omitempty"`
+}
+
+// Item is a manga inside a collection.
+type Item struct {
+	MangaID  string `json:"manga_id"`
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	Status   string `json:"status"`
+	Position int    `json:"position"`
+	Note     string `json:"note"`
+}
+
+const selectCollection = `
+	SELECT c.id, c.slug, c.user_id, COALESCE(u.username, ''), c.name, c.description,
+	       c.visibility, c.created_at, c.updated_at,
+	       (SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)
+	FROM collections c
+	LEFT JOIN users u ON CAST(u.id AS TEXT) = c.user_id
+`
+
+func scanCollection(row interface{ Scan(...any) error }) (*Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.Slug, &c.UserID, &c.Owner, &c.Name, &c.Description,
+		&c.Visibility, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListByUser returns the collections of userID. Private ones are only
+// included when includePrivate is set.
+func ListByUser(db *sql.DB, userID string, includePrivate bool) ([]Collection, error) {
+	rows, err := db.Query(selectCollection+`
+		WHERE c.user_id = ? AND (c.visibility = 'public' OR ?)
+		ORDER BY c.updated_at DESC
+	`, userID, includePrivate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+// GetOwned loads collection id if it belongs to userID.
+func GetOwned(db *sql.DB, id, userID string) (*Collection, error) {
+	c, err := scanCollection(db.QueryRow(selectCollection+`WHERE c.id = ? AND c.user_id = ?`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	return c, loadItems(db, c)
+}
+
+// GetPublic loads a public collection by slug.
+func GetPublic(db *sql.DB, slug string) (*Collection, error) {
+	c, err := scanCollection(db.QueryRow(selectCollection+`WHERE c.slug = ? AND c.visibility = 'public'`, slug))
+	if err != nil {
+		return nil, err
+	}
+	return c, loadItems(db, c)
+}
+
+func loadItems(db *sql.DB, c *Collection) error {
+	rows, err := db.Query(`
+		SELECT i.manga_id, COALESCE(m.title, ''), COALESCE(m.author, ''), COALESCE(m.status, ''),
+		       i.position, i.note
+		FROM collection_items i
+		JOIN manga m ON m.id = i.manga_id
+		WHERE i.collection_id = ? AND m.deleted_at IS NULL
+		ORDER BY i.position
+	`, c.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	c.Items = []Item{}
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.MangaID, &it.Title, &it.Author, &it.Status, &it.Position, &it.Note); err != nil {
+			return err
+		}
+		c.Items = append(c.Items, it)
+	}
+	return rows.Err()
+}
+
+// Create inserts a new collection and returns it.
+func Create(db *sql.DB, userID, name, description, visibility string) (*Collection, error) {
+	slug, err := newSlug(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO collections (user_id, slug, name, description, visibility)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, slug, name, description, visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := res.LastInsertId()
+	c, err := scanCollection(db.QueryRow(selectCollection+`WHERE c.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	c.Items = []Item{}
+	return c, nil
+}
+
+// Reorder rewrites item positions. Ids listed in order come first, any
+// item not listed keeps its relative order after them.
+func Reorder(db *sql.DB, collectionID int64, order []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT manga_id FROM collection_items WHERE collection_id = ? ORDER BY position
+	`, collectionID)
+	if err != nil {
+		return err
+	}
+	var current []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+
+	exists := make(map[string]bool, len(current))
+	for _, id := range current {
+		exists[id] = true
+	}
+
+	placed := make(map[string]bool, len(current))
+	next := make([]string, 0, len(current))
+	for _, id := range order {
+		if exists[id] && !placed[id] {
+			next = append(next, id)
+			placed[id] = true
+		}
+	}
+	for _, id := range current {
+		if !placed[id] {
+			next = append(next, id)
+		}
+	}
+
+	for i, id := range next {
+		if _, err := tx.Exec(`
+			UPDATE collection_items SET position = ? WHERE collection_id = ? AND manga_id = ?
+		`, i+1, collectionID, id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, collectionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func touch(db *sql.DB, collectionID int64) {
+	db.Exec(`UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, collectionID)
+}
+
+// newSlug builds a URL-safe slug from name with a random suffix so two
+// lists with the same name never collide.
+func newSlug(name string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 48 {
+			break
+		}
+	}
+	base := strings.Trim(b.String(), "-")
+	if base == "" {
+		base = "list"
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+func validVisibility(v string) bool {
+	return v == Public || v == Private
+}
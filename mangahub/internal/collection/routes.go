@@ -0,0 +1,307 @@
+package collection
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes = collection CRUD for the logged in user
+func RegisterRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/collections
+	// ---------------------------
+	r.GET("/users/collections", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		list, err := ListByUser(db, userID, true)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, list)
+	})
+
+	// ---------------------------
+	// POST /users/collections
+	// ---------------------------
+	r.POST("/users/collections", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Visibility  string `json:"visibility"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Visibility == "" {
+			req.Visibility = Private
+		}
+		if msg := validate(req.Name, req.Visibility); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		col, err := Create(db, userID, req.Name, req.Description, req.Visibility)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(201, col)
+	})
+
+	// ---------------------------
+	// GET /users/collections/:id
+	// ---------------------------
+	r.GET("/users/collections/:id", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(200, col)
+	})
+
+	// ---------------------------
+	// PUT /users/collections/:id
+	// ---------------------------
+	r.PUT("/users/collections/:id", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Visibility  string `json:"visibility"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if msg := validate(req.Name, req.Visibility); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		_, err := db.Exec(`
+			UPDATE collections
+			SET name=?, description=?, visibility=?, updated_at=CURRENT_TIMESTAMP
+			WHERE id=?`,
+			req.Name, req.Description, req.Visibility, col.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Collection updated"})
+	})
+
+	// ---------------------------
+	// DELETE /users/collections/:id
+	// ---------------------------
+	r.DELETE("/users/collections/:id", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM collections WHERE id = ?`, col.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"message": "Collection deleted"})
+	})
+
+	// ---------------------------
+	// POST /users/collections/:id/items
+	// ---------------------------
+	r.POST("/users/collections/:id/items", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			MangaID string `json:"manga_id"`
+			Note    string `json:"note"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.MangaID == "" {
+			c.JSON(400, gin.H{"error": "Missing manga_id"})
+			return
+		}
+
+		var exists int
+		db.QueryRow(`SELECT COUNT(*) FROM manga WHERE id = ? AND deleted_at IS NULL`, req.MangaID).Scan(&exists)
+		if exists == 0 {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+
+		_, err := db.Exec(`
+			INSERT INTO collection_items (collection_id, manga_id, position, note)
+			VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM collection_items WHERE collection_id = ?), ?)
+			ON CONFLICT(collection_id, manga_id) DO UPDATE SET note = excluded.note
+		`, col.ID, req.MangaID, col.ID, req.Note)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		touch(db, col.ID)
+
+		c.JSON(201, gin.H{"message": "Item added"})
+	})
+
+	// ---------------------------
+	// PUT /users/collections/:id/items/:manga_id (note)
+	// ---------------------------
+	r.PUT("/users/collections/:id/items/:manga_id", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Note string `json:"note"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		res, err := db.Exec(`
+			UPDATE collection_items SET note = ? WHERE collection_id = ? AND manga_id = ?
+		`, req.Note, col.ID, c.Param("manga_id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(404, gin.H{"error": "Item not in collection"})
+			return
+		}
+		touch(db, col.ID)
+
+		c.JSON(200, gin.H{"message": "Item updated"})
+	})
+
+	// ---------------------------
+	// DELETE /users/collections/:id/items/:manga_id
+	// ---------------------------
+	r.DELETE("/users/collections/:id/items/:manga_id", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`
+			DELETE FROM collection_items WHERE collection_id = ? AND manga_id = ?
+		`, col.ID, c.Param("manga_id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(404, gin.H{"error": "Item not in collection"})
+			return
+		}
+		touch(db, col.ID)
+
+		c.JSON(200, gin.H{"message": "Item removed"})
+	})
+
+	// ---------------------------
+	// PUT /users/collections/:id/order
+	// body: {"manga_ids": ["30002", "30001", ...]}
+	// ---------------------------
+	r.PUT("/users/collections/:id/order", func(c *gin.Context) {
+		col, ok := ownedCollection(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			MangaIDs []string `json:"manga_ids"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		if err := Reorder(db, col.ID, req.MangaIDs); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"message": "Collection reordered"})
+	})
+}
+
+// RegisterPublicRoutes = read-only pages for public lists
+func RegisterPublicRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /lists/:slug
+	// ---------------------------
+	r.GET("/lists/:slug", func(c *gin.Context) {
+		col, err := GetPublic(db, c.Param("slug"))
+		if err == ErrNotFound {
+			c.JSON(404, gin.H{"error": "Not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, col)
+	})
+}
+
+// ownedCollection loads :id for the current user, writing the error
+// response itself when that fails.
+func ownedCollection(c *gin.Context, db *sql.DB) (*Collection, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	col, err := GetOwned(db, c.Param("id"), userID)
+	if err == ErrNotFound {
+		c.JSON(404, gin.H{"error": "Not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return col, true
+}
+
+func validate(name, visibility string) string {
+	if name == "" {
+		return "Missing name"
+	}
+	if len(name) > maxNameLength {
+		return "Name too long"
+	}
+	if !validVisibility(visibility) {
+		return "visibility must be public or private"
+	}
+	return ""
+}
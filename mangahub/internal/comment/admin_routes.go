@@ -0,0 +1,82 @@
+package comment
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/auth"
+)
+
+func RegisterAdminRoutes(r *gin.RouterGroup, db *sql.DB) {
+	r = r.Group("", auth.RequirePermission(auth.PermReviewModerate))
+
+	// GET /admin/comments/reports (moderation queue)
+	r.GET("/comments/reports", func(c *gin.Context) {
+		limit, offset := pageParams(c)
+
+		queue, err := Queue(db, limit, offset)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, queue)
+	})
+
+	// POST /admin/comments/:id/resolve  {"action": "dismiss" | "delete"}
+	r.POST("/comments/:id/resolve", func(c *gin.Context) {
+		var req struct {
+			Action string `json:"action"`
+		}
+		if err := c.BindJSON(&req); err != nil || (req.Action != "dismiss" && req.Action != "delete") {
+			c.JSON(400, gin.H{"error": "action must be dismiss or delete"})
+			return
+		}
+
+		cm, err := Get(db, c.Param("id"))
+		if err == ErrNotFound {
+			c.JSON(404, gin.H{"error": "comment not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		adminID := c.GetString("user_id")
+
+		if req.Action == "delete" {
+			if err := SoftDelete(db, cm.ID, adminID); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		n, err := Resolve(db, cm.ID, adminID, req.Action)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "reports resolved", "resolved": n})
+	})
+
+	r.DELETE("/comments/:id", func(c *gin.Context) {
+		cm, err := Get(db, c.Param("id"))
+		if err == ErrNotFound {
+			c.JSON(404, gin.H{"error": "comment not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		adminID := c.GetString("user_id")
+		if err := SoftDelete(db, cm.ID, adminID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		Resolve(db, cm.ID, adminID, "delete")
+
+		c.JSON(200, gin.H{"message": "comment deleted"})
+	})
+}
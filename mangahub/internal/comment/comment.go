@@ -0,0 +1,170 @@
+package comment
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const maxBodyLength = 5000
+
+var ErrNotFound = errors.New("comment not found")
+
+// Comment is one post in a chapter thread. Deleted comments stay in the
+// tree so their replies keep their place, but lose body and author.
+type Comment struct {
+	ID        int64      `json:"id"`
+	ParentID  int64      `json:"parent_id,omitempty"`
+	MangaID   string     `json:"manga_id"`
+	Chapter   int        `json:"chapter"`
+	UserID    string     `json:"user_id,omitempty"`
+	Username  string     `json:"username,omitempty"`
+	Body      string     `json:"body"`
+	Spoiler   bool       `json:"spoiler"`
+	Edited    bool       `json:"edited"`
+	Deleted   bool       `json:"deleted"`
+	CreatedAt string     `json:"created_at"`
+	Replies   []*Comment `json:"replies"`
+}
+
+const selectComment = `
+	SELECT c.id, COALESCE(c.parent_id, 0), c.manga_id, c.chapter, c.user_id,
+	       COALESCE(u.username, ''), c.body, c.spoiler,
+	       c.edited_at IS NOT NULL, c.deleted_at IS NOT NULL, c.created_at
+	FROM comments c
+	LEFT JOIN users u ON CAST(u.id AS TEXT) = c.user_id
+`
+
+func scanComment(row interface{ Scan(...any) error }) (*Comment, error) {
+	var c Comment
+	err := row.Scan(&c.ID, &c.ParentID, &c.MangaID, &c.Chapter, &c.UserID,
+		&c.Username, &c.Body, &c.Spoiler, &c.Edited, &c.Deleted, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Replies = []*Comment{}
+	return &c, nil
+}
+
+// redact strips what a soft deleted comment should no longer show.
+func (c *Comment) redact() {
+	if c.Deleted {
+		c.UserID = ""
+		c.Username = ""
+		c.Body = ""
+		c.Spoiler = false
+	}
+}
+
+// Get loads a single comment, deleted or not.
+func Get(db *sql.DB, id string) (*Comment, error) {
+	return scanComment(db.QueryRow(selectComment+`WHERE c.id = ?`, id))
+}
+
+// Thread returns the comment tree of one chapter, oldest first at every
+// level.
+func Thread(db *sql.DB, mangaID string, chapter int) ([]*Comment, error) {
+	rows, err := db.Query(selectComment+`
+		WHERE c.manga_id = ? AND c.chapter = ?
+		ORDER BY c.id
+	`, mangaID, chapter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Comment)
+	roots := []*Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		c.redact()
+		byID[c.ID] = c
+
+		// parents always have a lower id, so they are already in byID
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	return roots, rows.Err()
+}
+
+// Create inserts a comment. A non-zero parentID must be a live comment
+// of the same chapter.
+func Create(db *sql.DB, mangaID string, chapter int, userID string, parentID int64, body string, spoiler bool) (*Comment, error) {
+	var parent sql.NullInt64
+	if parentID != 0 {
+		var pManga string
+		var pChapter int
+		var deleted bool
+		err := db.QueryRow(`
+			SELECT manga_id, chapter, deleted_at IS NOT NULL FROM comments WHERE id = ?
+		`, parentID).Scan(&pManga, &pChapter, &deleted)
+		if err != nil || deleted || pManga != mangaID || pChapter != chapter {
+			return nil, ErrNotFound
+		}
+		parent = sql.NullInt64{Int64: parentID, Valid: true}
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO comments (manga_id, chapter, user_id, parent_id, body, spoiler)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, mangaID, chapter, userID, parent, body, spoiler || HasSpoilerTag(body))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := res.LastInsertId()
+	return scanComment(db.QueryRow(selectComment+`WHERE c.id = ?`, id))
+}
+
+// Edit replaces the body of a live comment.
+func Edit(db *sql.DB, id int64, body string, spoiler bool) error {
+	_, err := db.Exec(`
+		UPDATE comments SET body = ?, spoiler = ?, edited_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL
+	`, body, spoiler || HasSpoilerTag(body), id)
+	return err
+}
+
+// SoftDelete hides a comment while keeping its place in the thread.
+func SoftDelete(db *sql.DB, id int64, by string) error {
+	_, err := db.Exec(`
+		UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, by, id)
+	return err
+}
+
+// HasSpoilerTag reports whether body marks part of itself with
+// [spoiler]...[/spoiler].
+func HasSpoilerTag(body string) bool {
+	lower := strings.ToLower(body)
+	open := strings.Index(lower, "[spoiler]")
+	return open >= 0 && strings.Contains(lower[open:], "[/spoiler]")
+}
+
+func validateBody(body string) string {
+	if body == "" {
+		return "Missing body"
+	}
+	if len(body) > maxBodyLength {
+		return "Comment too long"
+	}
+	return ""
+}
+
+// PurgeManga removes every chapter thread of mangaID, with the replies
+// and reports. Part of purging a manga from the trash; threads are not
+// archived.
+func PurgeManga(tx *sql.Tx, mangaID string) error {
+	_, err := tx.Exec(`DELETE FROM comments WHERE manga_id = ?`, mangaID)
+	return err
+}
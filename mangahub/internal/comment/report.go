@@ -0,0 +1,112 @@
+package comment
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrAlreadyReported = errors.New("already reported")
+
+// Report is one user's complaint about a comment.
+type Report struct {
+	ID         int64  `json:"id"`
+	ReporterID string `json:"reporter_id"`
+	Reason     string `json:"reason"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// QueueEntry is a reported comment waiting for a moderator.
+type QueueEntry struct {
+	Comment *Comment `json:"comment"`
+	Reports []Report `json:"reports"`
+}
+
+// FileReport records a report; each user can report a comment once.
+func FileReport(db *sql.DB, commentID int64, reporterID, reason string) error {
+	res, err := db.Exec(`
+		INSERT OR IGNORE INTO comment_reports (comment_id, reporter_id, reason)
+		VALUES (?, ?, ?)
+	`, commentID, reporterID, reason)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlreadyReported
+	}
+	return nil
+}
+
+// Queue returns comments with open reports, most reported first.
+func Queue(db *sql.DB, limit, offset int) ([]QueueEntry, error) {
+	rows, err := db.Query(`
+		SELECT comment_id
+		FROM comment_reports
+		WHERE resolved_at IS NULL
+		GROUP BY comment_id
+		ORDER BY COUNT(*) DESC, MIN(created_at)
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	queue := []QueueEntry{}
+	for _, id := range ids {
+		c, err := scanComment(db.QueryRow(selectComment+`WHERE c.id = ?`, id))
+		if err != nil {
+			return nil, err
+		}
+		reports, err := openReports(db, id)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, QueueEntry{Comment: c, Reports: reports})
+	}
+	return queue, nil
+}
+
+func openReports(db *sql.DB, commentID int64) ([]Report, error) {
+	rows, err := db.Query(`
+		SELECT id, reporter_id, reason, created_at
+		FROM comment_reports
+		WHERE comment_id = ? AND resolved_at IS NULL
+		ORDER BY id
+	`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Report{}
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.ReporterID, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// Resolve closes every open report on a comment.
+func Resolve(db *sql.DB, commentID int64, adminID, resolution string) (int64, error) {
+	res, err := db.Exec(`
+		UPDATE comment_reports
+		SET resolved_at = CURRENT_TIMESTAMP, resolved_by = ?, resolution = ?
+		WHERE comment_id = ? AND resolved_at IS NULL
+	`, adminID, resolution, commentID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
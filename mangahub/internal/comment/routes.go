@@ -0,0 +1,231 @@
+package comment
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/tcp"
+)
+
+// RegisterRoutes = comment writes for logged in users. New comments are
+// pushed to TCP subscribers of the chapter when emitter is set.
+func RegisterRoutes(r gin.IRouter, db *sql.DB, emitter *tcp.ProgressEmitter) {
+
+	// ---------------------------
+	// POST /manga/:id/chapters/:chapter/comments
+	// ---------------------------
+	r.POST("/manga/:id/chapters/:chapter/comments", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		mangaID, chapter, ok := threadParams(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Body     string `json:"body"`
+			Spoiler  bool   `json:"spoiler"`
+			ParentID int64  `json:"parent_id"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if msg := validateBody(req.Body); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		cm, err := Create(db, mangaID, chapter, userID, req.ParentID, req.Body, req.Spoiler)
+		if err == ErrNotFound {
+			c.JSON(400, gin.H{"error": "Parent comment not found in this thread"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 🔴 REAL-TIME PUSH (safe)
+		if emitter != nil {
+			_ = emitter.EmitComment(tcp.CommentEvent{
+				CommentID: cm.ID,
+				ParentID:  cm.ParentID,
+				MangaID:   cm.MangaID,
+				Chapter:   cm.Chapter,
+				UserID:    cm.UserID,
+				Username:  cm.Username,
+				Body:      cm.Body,
+				Spoiler:   cm.Spoiler,
+				Timestamp: time.Now().Unix(),
+			})
+		}
+
+		c.JSON(201, cm)
+	})
+
+	// ---------------------------
+	// PUT /comments/:id (edit own comment)
+	// ---------------------------
+	r.PUT("/comments/:id", func(c *gin.Context) {
+		cm, ok := ownComment(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Body    string `json:"body"`
+			Spoiler bool   `json:"spoiler"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if msg := validateBody(req.Body); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		if err := Edit(db, cm.ID, req.Body, req.Spoiler); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, _ := Get(db, c.Param("id"))
+		c.JSON(200, updated)
+	})
+
+	// ---------------------------
+	// DELETE /comments/:id (soft delete own comment)
+	// ---------------------------
+	r.DELETE("/comments/:id", func(c *gin.Context) {
+		cm, ok := ownComment(c, db)
+		if !ok {
+			return
+		}
+
+		if err := SoftDelete(db, cm.ID, cm.UserID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"message": "Comment deleted"})
+	})
+
+	// ---------------------------
+	// POST /comments/:id/report
+	// ---------------------------
+	r.POST("/comments/:id/report", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+			c.JSON(400, gin.H{"error": "Missing reason"})
+			return
+		}
+
+		cm, err := Get(db, c.Param("id"))
+		if err == ErrNotFound || (err == nil && cm.Deleted) {
+			c.JSON(404, gin.H{"error": "Not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = FileReport(db, cm.ID, userID, strings.TrimSpace(req.Reason))
+		if err == ErrAlreadyReported {
+			c.JSON(409, gin.H{"error": "You already reported this comment"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(201, gin.H{"message": "Report sent to moderators"})
+	})
+}
+
+// RegisterPublicRoutes = read-only chapter threads
+func RegisterPublicRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /manga/:id/chapters/:chapter/comments
+	// ---------------------------
+	r.GET("/manga/:id/chapters/:chapter/comments", func(c *gin.Context) {
+		mangaID, chapter, ok := threadParams(c, db)
+		if !ok {
+			return
+		}
+
+		thread, err := Thread(db, mangaID, chapter)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, thread)
+	})
+}
+
+func threadParams(c *gin.Context, db *sql.DB) (string, int, bool) {
+	mangaID := c.Param("id")
+	chapter, err := strconv.Atoi(c.Param("chapter"))
+	if err != nil || chapter <= 0 {
+		c.JSON(400, gin.H{"error": "Invalid chapter"})
+		return "", 0, false
+	}
+
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM manga WHERE id = ? AND deleted_at IS NULL`, mangaID).Scan(&n)
+	if n == 0 {
+		c.JSON(404, gin.H{"error": "Manga not found"})
+		return "", 0, false
+	}
+	return mangaID, chapter, true
+}
+
+// ownComment loads :id if it is a live comment of the current user,
+// writing the error response itself when that fails.
+func ownComment(c *gin.Context, db *sql.DB) (*Comment, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	cm, err := Get(db, c.Param("id"))
+	if err == ErrNotFound || (err == nil && (cm.UserID != userID || cm.Deleted)) {
+		c.JSON(404, gin.H{"error": "Not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return cm, true
+}
+
+func pageParams(c *gin.Context) (int, int) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
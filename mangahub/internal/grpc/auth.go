@@ -0,0 +1,130 @@
+package grpc
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"mangahub/internal/auth"
+	pb "mangahub/proto/manga"
+)
+
+// Calls may carry "authorization: Bearer <access token or API key>"
+// metadata. Calls without it work as before, so existing clients keep
+// going; calls with it must present a valid credential, and then may
+// only read or change their own progress and recommendations.
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the caller's claims, or nil for calls made
+// without credentials.
+func ClaimsFromContext(ctx context.Context) *auth.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims
+}
+
+// rpcScopes is the API key scope each call needs. Progress is personal
+// data, the same as on the HTTP API.
+var rpcScopes = map[string]string{
+	pb.MangaService_SearchManga_FullMethodName:     auth.ScopeCatalogRead,
+	pb.MangaService_GetManga_FullMethodName:        auth.ScopeCatalogRead,
+	pb.MangaService_GetCollection_FullMethodName:   auth.ScopeCatalogRead,
+	pb.MangaService_ListCollections_FullMethodName: auth.ScopeCatalogRead,
+	pb.MangaService_Recommend_FullMethodName:       auth.ScopeCatalogRead,
+	pb.MangaService_GetProgress_FullMethodName:     auth.ScopeProgressWrite,
+	pb.MangaService_UpdateProgress_FullMethodName:  auth.ScopeProgressWrite,
+}
+
+// AuthInterceptor checks the credential in the call metadata. db is
+// needed for API keys; without it only access tokens are accepted.
+func AuthInterceptor(db *sql.DB) ggrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *ggrpc.UnaryServerInfo, handler ggrpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		credential := strings.TrimPrefix(values[0], "Bearer ")
+		claims, err := auth.Authenticate(db, credential, peerIP(ctx))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if scope, ok := rpcScopes[info.FullMethod]; ok && !claims.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "api key needs the %s scope", scope)
+		}
+		if err := ownUserID(req, claims); err != nil {
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+// ownUserID fills in an empty user_id with the caller's and refuses
+// someone else's, except for admins. Recommend checks its own.
+func ownUserID(req any, claims *auth.Claims) error {
+	var userID *string
+	switch r := req.(type) {
+	case *pb.GetProgressRequest:
+		userID = &r.UserId
+	case *pb.ProgressRequest:
+		userID = &r.UserId
+	default:
+		return nil
+	}
+
+	if *userID == "" {
+		*userID = claims.UserID
+		return nil
+	}
+	if *userID != claims.UserID && claims.Role != auth.RoleAdmin {
+		return status.Error(codes.PermissionDenied, "user_id does not match the credential")
+	}
+	return nil
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	addr := p.Addr.String()
+	if i := strings.LastIndex(addr, ":"); i > 0 {
+		return strings.Trim(addr[:i], "[]")
+	}
+	return addr
+}
+
+// RPCPermissions lists the calls only some roles may make, by full
+// method name. Every call so far is a read or a user's own data; calls
+// that change the catalog belong here with auth.PermMangaWrite.
+var RPCPermissions = map[string][]string{}
+
+// RequirePermission is the gRPC side of auth.RequirePermission. It runs
+// after AuthInterceptor and refuses listed calls made without a
+// credential or without the permissions.
+func RequirePermission(methods map[string][]string) ggrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *ggrpc.UnaryServerInfo, handler ggrpc.UnaryHandler) (any, error) {
+		perms, ok := methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		claims := ClaimsFromContext(ctx)
+		if claims == nil {
+			return nil, status.Error(codes.Unauthenticated, "credential required")
+		}
+		for _, p := range perms {
+			if !claims.Can(p) {
+				return nil, status.Errorf(codes.PermissionDenied, "missing permission %s", p)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+
+	"mangahub/internal/collection"
+	pb "mangahub/proto/manga"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *GRPCMangaServer) GetCollection(ctx context.Context, req *pb.GetCollectionRequest) (*pb.CollectionResponse, error) {
+
+	col, err := collection.GetPublic(s.DB, req.Slug)
+	if err == collection.ErrNotFound {
+		return nil, status.Error(codes.NotFound, "collection not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CollectionResponse{
+		Slug:        col.Slug,
+		Name:        col.Name,
+		Description: col.Description,
+		Owner:       col.Owner,
+	}
+	for _, it := range col.Items {
+		resp.Items = append(resp.Items, &pb.SearchResult{
+			Id:     it.MangaID,
+			Title:  it.Title,
+			Author: it.Author,
+			Status: it.Status,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCMangaServer) ListCollections(ctx context.Context, req *pb.ListCollectionsRequest) (*pb.ListCollectionsResponse, error) {
+
+	list, err := collection.ListByUser(s.DB, req.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListCollectionsResponse{}
+	for _, col := range list {
+		resp.Collections = append(resp.Collections, &pb.CollectionSummary{
+			Slug:        col.Slug,
+			Name:        col.Name,
+			Description: col.Description,
+			ItemCount:   int32(col.ItemCount),
+		})
+	}
+
+	return resp, nil
+}
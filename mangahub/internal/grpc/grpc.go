@@ -4,58 +4,62 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"mangahub/internal/manga"
+	"mangahub/internal/recommend"
 	pb "mangahub/proto/manga"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCMangaServer struct {
 	pb.UnimplementedMangaServiceServer
-	DB *sql.DB
+	DB          *sql.DB
+	Catalog     *manga.Catalog
+	Recommender *recommend.Engine // optional, Recommend is unavailable without it
 }
 
 func (s *GRPCMangaServer) GetManga(ctx context.Context, req *pb.GetMangaRequest) (*pb.MangaResponse, error) {
 
-	row := s.DB.QueryRow(`
-        SELECT id, title, author, genres, status, total_chapters, description
-        FROM manga
-        WHERE id = ?
-    `, req.Id)
-
-	var m pb.MangaResponse
-	var genresText string
-
-	if err := row.Scan(&m.Id, &m.Title, &m.Author, &genresText, &m.Status, &m.TotalChapters, &m.Description); err != nil {
+	m, err := s.Catalog.Get(req.Id)
+	if err == manga.ErrNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	json.Unmarshal([]byte(genresText), &m.Genres)
-
-	return &m, nil
+	// the message carries genres as JSON text
+	genres, _ := json.Marshal(m.Genres)
+
+	return &pb.MangaResponse{
+		Id:            m.ID,
+		Title:         m.Title,
+		Author:        m.Author,
+		Genres:        string(genres),
+		Status:        m.Status,
+		TotalChapters: int32(m.TotalChapters),
+		Description:   m.Description,
+		Score:         m.Score,
+		VoteCount:     int32(m.VoteCount),
+	}, nil
 }
 
 func (s *GRPCMangaServer) SearchManga(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
 
-	rows, err := s.DB.Query(`
-        SELECT id, title, author, status
-        FROM manga
-        WHERE (title LIKE '%' || ? || '%' OR ? = '')
-        AND (genres LIKE '%' || ? || '%' OR ? = '')
-        AND (status = ? OR ? = '')
-        LIMIT ?
-    `, req.Query, req.Query,
-		req.Genre, req.Genre,
-		req.Status, req.Status,
-		req.Limit,
-	)
+	list, err := s.Catalog.Search(req.Query, req.Genre, req.Status, int(req.Limit))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	resp := &pb.SearchResponse{}
-	for rows.Next() {
-		var r pb.SearchResult
-		rows.Scan(&r.Id, &r.Title, &r.Author, &r.Status)
-		resp.Results = append(resp.Results, &r)
+	for _, m := range list {
+		resp.Results = append(resp.Results, &pb.SearchResult{
+			Id:     m.ID,
+			Title:  m.Title,
+			Author: m.Author,
+			Status: m.Status,
+		})
 	}
 
 	return resp, nil
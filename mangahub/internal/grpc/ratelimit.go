@@ -0,0 +1,36 @@
+package grpc
+
+import (
+	"context"
+
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mangahub/internal/ratelimit"
+)
+
+// RateLimit applies g to every call, as "GRPC <full method>". It runs
+// after AuthInterceptor: callers with a credential are limited by API
+// key or user, the others by IP. The X-RateLimit-* values go back as
+// response headers (lowercased, as gRPC metadata is).
+func RateLimit(g *ratelimit.Guard) ggrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *ggrpc.UnaryServerInfo, handler ggrpc.UnaryHandler) (any, error) {
+		subject := ratelimit.IP(peerIP(ctx))
+		if claims := ClaimsFromContext(ctx); claims != nil {
+			if claims.APIKeyID != "" {
+				subject = ratelimit.APIKey(claims.APIKeyID)
+			} else {
+				subject = ratelimit.User(claims.UserID)
+			}
+		}
+
+		r := g.Allow(subject, "GRPC "+info.FullMethod)
+		ggrpc.SetHeader(ctx, metadata.New(r.Headers()))
+		if !r.Allowed {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %ds", r.RetrySeconds())
+		}
+		return handler(ctx, req)
+	}
+}
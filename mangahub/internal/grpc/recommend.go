@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+
+	pb "mangahub/proto/manga"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recommend answers for the caller only: the reasons name titles from
+// their library and ratings, which nobody else may see.
+func (s *GRPCMangaServer) Recommend(ctx context.Context, req *pb.RecommendRequest) (*pb.RecommendResponse, error) {
+
+	if s.Recommender == nil {
+		return nil, status.Error(codes.Unavailable, "recommendations not enabled")
+	}
+	claims := ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, status.Error(codes.Unauthenticated, "recommendations need a credential")
+	}
+	if req.UserId != "" && req.UserId != claims.UserID {
+		return nil, status.Error(codes.PermissionDenied, "user_id does not match the credential")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	list, err := s.Recommender.Recommend(claims.UserID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RecommendResponse{}
+	for _, r := range list {
+		resp.Recommendations = append(resp.Recommendations, &pb.Recommendation{
+			Manga: &pb.SearchResult{
+				Id:     r.MangaID,
+				Title:  r.Title,
+				Author: r.Author,
+				Status: r.Status,
+			},
+			Score:  r.Score,
+			Reason: r.Reason,
+		})
+	}
+
+	return resp, nil
+}
@@ -1,69 +1,236 @@
 package manga
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"mangahub/internal/udp"
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
 )
 
-func RegisterAdminRoutes(
-	r *gin.RouterGroup,
-	db *sql.DB,
-	udpServer *udp.NotificationServer,
-) {
+func RegisterAdminRoutes(r *gin.RouterGroup, catalog *Catalog) {
+	db := catalog.db
 
-	r.POST("/manga", func(c *gin.Context) {
+	r.POST("/manga", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
 		var m Manga
 		if err := c.BindJSON(&m); err != nil {
 			c.JSON(400, gin.H{"error": "invalid json"})
 			return
 		}
 
-		genres := strings.Join(m.Genres, ",")
+		if err := catalog.Create(&m, editor(c)); err != nil {
+			catalogError(c, err)
+			return
+		}
+
+		e := audit.FromRequest(c, "manga.create", "manga", m.ID)
+		e.After = m
+		audit.Record(db, e)
+
+		c.JSON(201, gin.H{"message": "manga added", "manga": m})
+	})
+
+	r.DELETE("/manga/:id", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		id := c.Param("id")
+
+		before, err := catalog.Delete(id, editor(c))
+		if err != nil {
+			catalogError(c, err)
+			return
+		}
+
+		e := audit.FromRequest(c, "manga.delete", "manga", id)
+		e.Before = before
+		audit.Record(db, e)
 
-		_, err := db.Exec(`
-			INSERT INTO manga (id, title, author, genres, status, total_chapters, description)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
-			m.ID,
-			m.Title,
-			m.Author,
-			genres,
-			m.Status,
-			m.TotalChapters,
-			m.Description,
-		)
+		c.JSON(200, gin.H{"message": "manga moved to the trash"})
+	})
 
+	// GET /admin/manga/trash
+	// deleted manga, with when the purge will remove them
+	r.GET("/manga/trash", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		list, err := catalog.Trash()
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		fmt.Println("📢 Broadcast called")
-		fmt.Printf("UDP SERVER POINTER: %+v\n", udpServer)
 
-		// ✅ DIRECT UDP NOTIFY
-		udpServer.Broadcast(udp.Notification{
-			Type:      "NEW_MANGA",
-			MangaID:   m.ID,
-			Message:   "New manga added: " + m.Title,
-			Timestamp: time.Now().Unix(),
-		})
+		type entry struct {
+			Manga
+			PurgeAt time.Time `json:"purge_at"`
+		}
+		res := make([]entry, 0, len(list))
+		for _, m := range list {
+			res = append(res, entry{m, m.DeletedAt.Add(catalog.Retention)})
+		}
+		c.JSON(200, gin.H{"trash": res, "retention_days": int(catalog.Retention.Hours() / 24)})
+	})
+
+	// POST /admin/manga/:id/restore
+	r.POST("/manga/:id/restore", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		id := c.Param("id")
+
+		m, err := catalog.Restore(id, editor(c))
+		if err != nil {
+			catalogError(c, err)
+			return
+		}
+
+		audit.Record(db, audit.FromRequest(c, "manga.restore", "manga", id))
 
-		c.JSON(201, gin.H{"message": "manga added"})
+		c.Header("ETag", m.ETag())
+		c.JSON(200, m)
 	})
 
-	r.DELETE("/manga/:id", func(c *gin.Context) {
+	// PATCH /admin/manga/:id  (JSON Merge Patch, If-Match: "<version>")
+	// answers with the manga as stored and its new ETag
+	r.PATCH("/manga/:id", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		ifMatch := c.GetHeader("If-Match")
+		if ifMatch == "" {
+			c.JSON(428, gin.H{"error": "If-Match with the manga's ETag is required"})
+			return
+		}
+		patch, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+
 		id := c.Param("id")
+		before, after, err := catalog.Patch(id, ifMatch, patch, editor(c))
+		if err == ErrVersionMismatch {
+			c.Header("ETag", before.ETag())
+			c.JSON(412, gin.H{"error": err.Error(), "version": before.Version})
+			return
+		}
+		if err != nil {
+			catalogError(c, err)
+			return
+		}
 
-		if _, err := db.Exec(`DELETE FROM manga WHERE id = ?`, id); err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		if after.Version != before.Version {
+			e := audit.FromRequest(c, "manga.update", "manga", id)
+			e.Before, e.After = ChangedFields(before, after)
+			audit.Record(db, e)
+		}
+
+		c.Header("ETag", after.ETag())
+		c.JSON(200, after)
+	})
+
+	// GET /admin/manga/:id/revisions?limit=50
+	// newest first; the ETag is the version a revert has to name
+	r.GET("/manga/:id/revisions", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if limit <= 0 || limit > 500 {
+			limit = 50
+		}
+
+		id := c.Param("id")
+		list, err := catalog.Revisions(id, limit)
+		if err != nil {
+			catalogError(c, err)
+			return
+		}
+
+		res := gin.H{"manga_id": id, "revisions": list}
+		if m, err := catalog.Get(id); err == nil {
+			c.Header("ETag", m.ETag())
+			res["version"] = m.Version
+		}
+		c.JSON(200, res)
+	})
+
+	// POST /admin/manga/:id/revisions/:rev/revert  (If-Match: "<version>")
+	// puts the fields of that revision back, as a new revision
+	r.POST("/manga/:id/revisions/:rev/revert", auth.RequirePermission(auth.PermMangaWrite), func(c *gin.Context) {
+		ifMatch := c.GetHeader("If-Match")
+		if ifMatch == "" {
+			c.JSON(428, gin.H{"error": "If-Match with the manga's ETag is required"})
+			return
+		}
+		rev, err := strconv.ParseInt(c.Param("rev"), 10, 64)
+		if err != nil {
+			c.JSON(404, gin.H{"error": ErrRevisionNotFound.Error()})
+			return
+		}
+
+		id := c.Param("id")
+		before, after, err := catalog.Revert(id, rev, ifMatch, editor(c))
+		if err == ErrVersionMismatch {
+			c.Header("ETag", before.ETag())
+			c.JSON(412, gin.H{"error": err.Error(), "version": before.Version})
+			return
+		}
+		if err != nil {
+			catalogError(c, err)
 			return
 		}
 
-		c.JSON(200, gin.H{"message": "manga deleted"})
+		if after.Version != before.Version {
+			e := audit.FromRequest(c, "manga.revert", "manga", id)
+			from, to := ChangedFields(before, after)
+			to["revision"] = rev
+			e.Before, e.After = from, to
+			audit.Record(db, e)
+		}
+
+		c.Header("ETag", after.ETag())
+		c.JSON(200, after)
+	})
+
+	// POST /admin/manga/:id/chapters  {"chapter": 42}
+	// announces a newly uploaded chapter
+	r.POST("/manga/:id/chapters", auth.RequirePermission(auth.PermChapterUpload), func(c *gin.Context) {
+		var req struct {
+			Chapter int `json:"chapter"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.Chapter <= 0 {
+			c.JSON(400, gin.H{"error": "chapter must be a positive number"})
+			return
+		}
+
+		id := c.Param("id")
+		total, err := catalog.ReleaseChapter(id, req.Chapter, editor(c))
+		if err == ErrChapterExists {
+			c.JSON(409, gin.H{"error": fmt.Sprintf("chapter %d is already out", req.Chapter)})
+			return
+		}
+		if err != nil {
+			catalogError(c, err)
+			return
+		}
+
+		e := audit.FromRequest(c, "manga.chapter_release", "manga", id)
+		e.Before = map[string]int{"total_chapters": total}
+		e.After = map[string]int{"total_chapters": req.Chapter}
+		audit.Record(db, e)
+
+		c.JSON(200, gin.H{"message": "chapter released", "total_chapters": req.Chapter})
 	})
 }
+
+// editor is the admin making the request, for the revision history.
+func editor(c *gin.Context) Editor {
+	return Editor{ID: c.GetString("user_id"), Name: c.GetString("username")}
+}
+
+// catalogError answers with the status that fits a Catalog error.
+func catalogError(c *gin.Context, err error) {
+	var invalid InvalidError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case err == ErrNotFound, err == ErrRevisionNotFound:
+		c.JSON(404, gin.H{"error": err.Error()})
+	case err == ErrExists, err == ErrInTrash, err == ErrChapterExists:
+		c.JSON(409, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
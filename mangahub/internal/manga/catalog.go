@@ -0,0 +1,271 @@
+package manga
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mangahub/internal/review"
+	"mangahub/internal/udp"
+)
+
+// Catalog is the only writer of the manga table. HTTP, gRPC and the
+// JSON importer all go through it, so rows are checked and stored the
+// same way, readers are notified and OnCatalogChange hooks run.
+
+var (
+	ErrNotFound      = errors.New("manga not found")
+	ErrExists        = errors.New("a manga with this id already exists")
+	ErrChapterExists = errors.New("chapter is already out")
+)
+
+// InvalidError is a manga that cannot be stored; the text says why.
+type InvalidError string
+
+func (e InvalidError) Error() string { return string(e) }
+
+// Statuses a manga can have, as the AniList data we import uses them.
+var Statuses = []string{"RELEASING", "FINISHED", "CANCELLED", "HIATUS", "NOT_YET_RELEASED"}
+
+const (
+	maxIDLen          = 64
+	maxTitleLen       = 200
+	maxAuthorLen      = 200
+	maxGenreLen       = 40
+	maxDescriptionLen = 10000
+)
+
+// Notifier tells connected readers about catalog news. The UDP
+// notification server is one; nil sends nothing.
+type Notifier interface {
+	Broadcast(udp.Notification)
+}
+
+type Catalog struct {
+	db     *sql.DB
+	notify Notifier
+
+	// Retention is how long deleted manga stay in the trash
+	Retention time.Duration
+}
+
+// DefaultRetention keeps deleted manga restorable for 30 days.
+const DefaultRetention = 30 * 24 * time.Hour
+
+func NewCatalog(db *sql.DB, notify Notifier) *Catalog {
+	return &Catalog{db: db, notify: notify, Retention: DefaultRetention}
+}
+
+// Get returns one manga with its rating.
+func (c *Catalog) Get(id string) (Manga, error) {
+	m, err := scanManga(c.db.QueryRow(selectManga+"AND m.id = ?", id), review.GlobalMean(c.db))
+	if err == sql.ErrNoRows {
+		return m, ErrNotFound
+	}
+	return m, err
+}
+
+// List returns the whole catalog.
+func (c *Catalog) List() ([]Manga, error) {
+	return c.query(selectManga)
+}
+
+// Search finds manga whose title contains query, with genre among its
+// genres and the given status. Empty arguments match everything.
+func (c *Catalog) Search(query, genre, status string, limit int) ([]Manga, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return c.query(selectManga+`
+		AND (m.title LIKE '%' || ? || '%' OR ? = '')
+		AND (m.genres LIKE '%' || ? || '%' OR ? = '')
+		AND (m.status = ? OR ? = '')
+		LIMIT ?
+	`, query, query, genre, genre, status, status, limit)
+}
+
+func (c *Catalog) query(q string, args ...any) ([]Manga, error) {
+	rows, err := c.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mean := review.GlobalMean(c.db)
+
+	var list []Manga
+	for rows.Next() {
+		m, err := scanManga(rows, mean)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// Create validates m, stores it and announces it.
+func (c *Catalog) Create(m *Manga, by Editor) error {
+	if err := c.insert(m, "create", by); err != nil {
+		return err
+	}
+	c.broadcast(udp.Notification{
+		Type:    "NEW_MANGA",
+		MangaID: m.ID,
+		Message: "New manga added: " + m.Title,
+	})
+	catalogChanged()
+	return nil
+}
+
+// Import stores items without announcing each one and returns the
+// rows that failed by id; the hooks run once at the end.
+func (c *Catalog) Import(items []Manga, by Editor) (added int, failed map[string]error) {
+	failed = make(map[string]error)
+	for i := range items {
+		if err := c.insert(&items[i], "import", by); err != nil {
+			failed[items[i].ID] = err
+			continue
+		}
+		added++
+	}
+	if added > 0 {
+		catalogChanged()
+	}
+	return added, failed
+}
+
+func (c *Catalog) insert(m *Manga, action string, by Editor) error {
+	if err := Normalize(m); err != nil {
+		return err
+	}
+	_, after, err := c.change(m.ID, action, by, 0, func(tx *sql.Tx, before Manga) error {
+		switch {
+		case before.DeletedAt != nil:
+			return ErrInTrash
+		case before.ID != "":
+			return ErrExists
+		}
+		_, err := tx.Exec(`
+			INSERT INTO manga (id, title, author, genres, status, total_chapters, description)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Title, m.Author, encodeGenres(m.Genres), m.Status, m.TotalChapters, m.Description,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	*m = after
+	return nil
+}
+
+// ReleaseChapter moves the chapter count up to chapter and announces
+// it. It returns the count from before.
+func (c *Catalog) ReleaseChapter(id string, chapter int, by Editor) (int, error) {
+	before, after, err := c.change(id, "chapter_release", by, 0, func(tx *sql.Tx, before Manga) error {
+		if before.ID == "" || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if chapter <= before.TotalChapters {
+			return ErrChapterExists
+		}
+		_, err := tx.Exec(`UPDATE manga SET total_chapters = ?, version = version + 1 WHERE id = ?`, chapter, id)
+		return err
+	})
+	if err != nil {
+		return before.TotalChapters, err
+	}
+
+	c.broadcast(chapterNews(after))
+	catalogChanged()
+	return before.TotalChapters, nil
+}
+
+func chapterNews(m Manga) udp.Notification {
+	return udp.Notification{
+		Type:    "chapter_release",
+		MangaID: m.ID,
+		Message: fmt.Sprintf("Chapter %d of %s is out", m.TotalChapters, m.Title),
+	}
+}
+
+func statusNews(m Manga) udp.Notification {
+	return udp.Notification{
+		Type:    "status_change",
+		MangaID: m.ID,
+		Message: fmt.Sprintf("%s is now %s", m.Title, strings.ToLower(strings.ReplaceAll(m.Status, "_", " "))),
+	}
+}
+
+func (c *Catalog) broadcast(note udp.Notification) {
+	if c.notify == nil {
+		return
+	}
+	note.Timestamp = time.Now().Unix()
+	c.notify.Broadcast(note)
+}
+
+// Normalize trims m and checks it can be stored. Genres lose blanks
+// and repeats; status is matched case-insensitively against Statuses.
+func Normalize(m *Manga) error {
+	m.ID = strings.TrimSpace(m.ID)
+	m.Title = strings.TrimSpace(m.Title)
+	m.Author = strings.TrimSpace(m.Author)
+	m.Description = strings.TrimSpace(m.Description)
+
+	switch {
+	case m.ID == "" || len(m.ID) > maxIDLen || strings.ContainsAny(m.ID, "/?# \t\n"):
+		return invalid("id must be 1 to %d characters without spaces, / ? or #", maxIDLen)
+	case m.Title == "" || len(m.Title) > maxTitleLen:
+		return invalid("title must be 1 to %d characters", maxTitleLen)
+	case len(m.Author) > maxAuthorLen:
+		return invalid("author must be at most %d characters", maxAuthorLen)
+	case len(m.Description) > maxDescriptionLen:
+		return invalid("description must be at most %d characters", maxDescriptionLen)
+	case m.TotalChapters < 0:
+		return InvalidError("total_chapters cannot be negative")
+	}
+
+	if m.Status != "" {
+		status := strings.ToUpper(strings.TrimSpace(m.Status))
+		m.Status = ""
+		for _, s := range Statuses {
+			if status == s {
+				m.Status = s
+			}
+		}
+		if m.Status == "" {
+			return invalid("status must be one of %s", strings.Join(Statuses, ", "))
+		}
+	}
+
+	genres := []string{}
+	seen := map[string]bool{}
+	for _, g := range m.Genres {
+		g = strings.TrimSpace(g)
+		if g == "" || seen[strings.ToLower(g)] {
+			continue
+		}
+		if len(g) > maxGenreLen {
+			return invalid("genres must be at most %d characters each", maxGenreLen)
+		}
+		seen[strings.ToLower(g)] = true
+		genres = append(genres, g)
+	}
+	m.Genres = genres
+	return nil
+}
+
+func invalid(format string, args ...any) error {
+	return InvalidError(fmt.Sprintf(format, args...))
+}
+
+// encodeGenres is the stored form of genres, a JSON array.
+func encodeGenres(genres []string) string {
+	b, _ := json.Marshal(genres)
+	return string(b)
+}
@@ -0,0 +1,26 @@
+package manga
+
+import "sync"
+
+var (
+	hooksMu     sync.Mutex
+	changeHooks []func()
+)
+
+// OnCatalogChange registers fn to run after any write to the manga
+// table made through this package.
+func OnCatalogChange(fn func()) {
+	hooksMu.Lock()
+	changeHooks = append(changeHooks, fn)
+	hooksMu.Unlock()
+}
+
+func catalogChanged() {
+	hooksMu.Lock()
+	hooks := append([]func(){}, changeHooks...)
+	hooksMu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+}
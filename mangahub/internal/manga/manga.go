@@ -1,12 +1,17 @@
 package manga
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
-	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/auth"
+	"mangahub/internal/review"
+	"mangahub/internal/trending"
 )
 
 // Manga struct
@@ -18,6 +23,58 @@ type Manga struct {
 	Status        string   `json:"status"`
 	TotalChapters int      `json:"total_chapters"`
 	Description   string   `json:"description"`
+	Score         float64  `json:"score"`
+	VoteCount     int      `json:"vote_count"`
+	Version       int      `json:"version"` // goes up with every change, see ETag
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // in the trash since
+}
+
+// selectAnyManga reads manga rows with their rating totals, including
+// the ones in the trash
+const selectAnyManga = `
+	SELECT m.id, m.title, m.author, m.genres, m.status, m.total_chapters, m.description,
+	       m.version, m.deleted_at, COALESCE(s.score_sum, 0), COALESCE(s.vote_count, 0)
+	FROM manga m
+	LEFT JOIN manga_scores s ON s.manga_id = m.id
+`
+
+// selectManga is selectAnyManga without the trash; add conditions
+// with AND
+const selectManga = selectAnyManga + `WHERE m.deleted_at IS NULL
+`
+
+func scanManga(row interface{ Scan(...any) error }, mean float64) (Manga, error) {
+	var m Manga
+	var genres sql.NullString
+	var scoreSum int
+	var deleted sql.NullTime
+	err := row.Scan(&m.ID, &m.Title, &m.Author, &genres, &m.Status, &m.TotalChapters, &m.Description,
+		&m.Version, &deleted, &scoreSum, &m.VoteCount)
+	if deleted.Valid {
+		m.DeletedAt = &deleted.Time
+	}
+	m.Genres = DecodeGenres(genres.String)
+	m.Score = review.Bayesian(scoreSum, m.VoteCount, mean)
+	return m, err
+}
+
+// DecodeGenres accepts both the JSON text the Catalog writes and the
+// comma separated form older admin routes wrote.
+func DecodeGenres(text string) []string {
+	genres := []string{}
+	if text == "" {
+		return genres
+	}
+	if strings.HasPrefix(text, "[") && json.Unmarshal([]byte(text), &genres) == nil {
+		return genres
+	}
+	for _, g := range strings.Split(text, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
 }
 
 // Latest update struct for endpoint
@@ -26,159 +83,137 @@ type LatestUpdate struct {
 	Message string `json:"message"`
 }
 
-// RegisterRoutes = all manga routes in one file
-func RegisterRoutes(r *gin.Engine, db *sql.DB) {
+// Activity is one thing a reader did, for the dashboard feed
+type Activity struct {
+	MangaID   string `json:"manga_id"`
+	Title     string `json:"title"`
+	Username  string `json:"username"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	CreatedAt string `json:"created_at"`
+}
+
+// RegisterRoutes = the public, read-only manga routes. Changes go
+// through the admin routes and the Catalog.
+func RegisterRoutes(r *gin.Engine, catalog *Catalog) {
+	db := catalog.db
 
 	// ---------------------------
 	// GET /manga (all manga)
 	// ---------------------------
 	r.GET("/manga", func(c *gin.Context) {
-		rows, err := db.Query("SELECT id, title, author, genres, status, total_chapters, description FROM manga")
+		list, err := catalog.List()
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
-
-		var list []Manga
-		for rows.Next() {
-			var m Manga
-			rows.Scan(&m.ID, &m.Title, &m.Author, &m.Genres, &m.Status, &m.TotalChapters, &m.Description)
-			list = append(list, m)
-		}
 		c.JSON(200, list)
 	})
 
 	// ---------------------------
 	// GET /manga/:id
 	// ---------------------------
-	r.GET("/manga/:id", func(c *gin.Context) {
+	// signed-in readers count as one viewer wherever they read from
+	r.GET("/manga/:id", auth.OptionalAuth(db), func(c *gin.Context) {
 		id := c.Param("id")
 
-		var m Manga
-		err := db.QueryRow("SELECT id, title, author, genres, status, total_chapters, description FROM manga WHERE id = ?", id).
-			Scan(&m.ID, &m.Title, &m.Author, &m.Genres, &m.Status, &m.TotalChapters, &m.Description)
+		m, err := catalog.Get(id)
 
-		if err == sql.ErrNoRows {
+		if err == ErrNotFound {
 			c.JSON(404, gin.H{"error": "Not found"})
 			return
 		} else if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		_ = trending.RecordView(db, id, c.GetString("user_id"), c.ClientIP())
 
+		c.Header("ETag", m.ETag())
 		c.JSON(200, m)
 	})
 
 	// ---------------------------
-	// POST /manga (add manga)
-	// ---------------------------
-	r.POST("/manga", func(c *gin.Context) {
-		var m Manga
-		if err := c.BindJSON(&m); err != nil {
-			c.JSON(400, gin.H{"error": "Invalid JSON"})
-			return
-		}
-
-		_, err := db.Exec(`
-			INSERT INTO manga (id, title, author, genres, status, total_chapters, description)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
-			m.ID, m.Title, m.Author, m.Genres, m.Status, m.TotalChapters, m.Description,
-		)
-
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.JSON(200, gin.H{"message": "Manga added successfully"})
-
-		// AUTO UDP NOTIFICATION
-		note := map[string]interface{}{
-			"type":    "manga_added",
-			"title":   m.Title,
-			"message": "New manga added: " + m.Title,
-		}
-
-		data, _ := json.Marshal(note)
-		http.Post("http://127.0.0.1:9094/broadcast", "application/json", bytes.NewBuffer(data))
-	})
-
-	// ---------------------------
-	// PUT /manga/:id (update)
+	// GET /manga/latest-chapters
 	// ---------------------------
-	r.PUT("/manga/:id", func(c *gin.Context) {
-		id := c.Param("id")
-
-		var m Manga
-		if err := c.BindJSON(&m); err != nil {
-			c.JSON(400, gin.H{"error": "Invalid JSON"})
-			return
-		}
-
-		_, err := db.Exec(`
-			UPDATE manga
-			SET title=?, author=?, genres=?, status=?, total_chapters=?, description=?
-			WHERE id=?`,
-			m.Title, m.Author, m.Genres, m.Status, m.TotalChapters, m.Description, id)
+	r.GET("/manga/latest-chapters", func(c *gin.Context) {
 
+		rows, err := db.Query(`
+			SELECT title, 'New chapter released for ' || title AS msg
+			FROM manga
+			WHERE deleted_at IS NULL
+			ORDER BY id DESC
+			LIMIT 10
+		`)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		defer rows.Close()
 
-		c.JSON(200, gin.H{"message": "Manga updated successfully"})
+		var list []LatestUpdate
 
-		// AUTO UDP NOTIFICATION
-		note := map[string]interface{}{
-			"type":    "chapter_release",
-			"title":   m.Title,
-			"message": "New chapter released for " + m.Title,
+		for rows.Next() {
+			var u LatestUpdate
+			rows.Scan(&u.Title, &u.Message)
+			list = append(list, u)
 		}
 
-		data, _ := json.Marshal(note)
-		http.Post("http://127.0.0.1:9094/broadcast", "application/json", bytes.NewBuffer(data))
+		c.JSON(200, list)
 	})
 
 	// ---------------------------
-	// DELETE /manga/:id
+	// GET /manga/latest-activity (real reader activity for the dashboard)
 	// ---------------------------
-	r.DELETE("/manga/:id", func(c *gin.Context) {
-		id := c.Param("id")
-
-		_, err := db.Exec("DELETE FROM manga WHERE id = ?", id)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+	r.GET("/manga/latest-activity", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if limit <= 0 || limit > 100 {
+			limit = 20
 		}
-		c.JSON(200, gin.H{"message": "Manga deleted"})
-	})
-
-	// ---------------------------
-	// GET /manga/latest-chapters
-	// ---------------------------
-	r.GET("/manga/latest-chapters", func(c *gin.Context) {
 
+		// readers who keep their profile, library or ratings private
+		// show up as "someone"
 		rows, err := db.Query(`
-			SELECT title, 'New chapter released for ' || title AS msg
-			FROM manga
-			ORDER BY id DESC
-			LIMIT 10
-		`)
+			SELECT a.manga_id, m.title,
+			       CASE
+			           WHEN u.username IS NULL OR COALESCE(p.profile_public, 1) = 0 THEN 'someone'
+			           WHEN a.kind = ? AND COALESCE(p.show_ratings, 1) = 0 THEN 'someone'
+			           WHEN a.kind != ? AND COALESCE(p.show_library, 1) = 0 THEN 'someone'
+			           ELSE u.username
+			       END,
+			       a.kind, a.created_at
+			FROM manga_activity a
+			JOIN manga m ON m.id = a.manga_id
+			LEFT JOIN users u ON CAST(u.id AS TEXT) = a.user_id
+			LEFT JOIN user_preferences p ON p.user_id = a.user_id
+			WHERE a.kind != ? AND m.deleted_at IS NULL
+			ORDER BY a.id DESC
+			LIMIT ?
+		`, trending.KindRating, trending.KindRating, trending.KindView, limit)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		defer rows.Close()
 
-		var list []LatestUpdate
+		list := []Activity{}
 
 		for rows.Next() {
-			var u LatestUpdate
-			rows.Scan(&u.Title, &u.Message)
-			list = append(list, u)
+			var a Activity
+			rows.Scan(&a.MangaID, &a.Title, &a.Username, &a.Kind, &a.CreatedAt)
+			a.Message = activityMessage(a)
+			list = append(list, a)
 		}
 
 		c.JSON(200, list)
 	})
 }
+
+func activityMessage(a Activity) string {
+	switch a.Kind {
+	case trending.KindLibraryAdd:
+		return a.Username + " started reading " + a.Title
+	case trending.KindRating:
+		return a.Username + " rated " + a.Title
+	}
+	return a.Username + " read more of " + a.Title
+}
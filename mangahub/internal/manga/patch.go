@@ -0,0 +1,189 @@
+package manga
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Changes to existing manga are JSON Merge Patches (RFC 7396) against
+// the manga as GET /manga/:id shows it. Every stored change bumps the
+// version, and a patch names the version it was written against, so
+// two editors cannot overwrite each other without noticing.
+
+var ErrVersionMismatch = errors.New("manga was changed since that version")
+
+// patchable are the fields a patch may touch; the rest are derived or
+// kept by the server.
+var patchable = []string{"title", "author", "genres", "status", "total_chapters", "description"}
+
+// ETag is the entity tag for this version of m.
+func (m Manga) ETag() string {
+	return `"` + strconv.Itoa(m.Version) + `"`
+}
+
+// MatchesETag reports whether an If-Match header value names m's
+// current version. "*" matches any version.
+func (m Manga) MatchesETag(ifMatch string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == m.ETag() {
+			return true
+		}
+	}
+	return false
+}
+
+// Patch applies a merge patch to the manga id if ifMatch still names
+// its current version. A patch that changes nothing stores nothing and
+// keeps the version.
+//
+// On ErrVersionMismatch, before is the current manga.
+func (c *Catalog) Patch(id, ifMatch string, patch []byte, by Editor) (before, after Manga, err error) {
+	before, after, err = c.change(id, "update", by, 0, func(tx *sql.Tx, before Manga) error {
+		if before.ID == "" || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if !before.MatchesETag(ifMatch) {
+			return ErrVersionMismatch
+		}
+		after, err := applyPatch(before, patch)
+		if err != nil {
+			return err
+		}
+		return update(tx, before, after)
+	})
+	if err == nil {
+		c.announce(before, after)
+	}
+	return before, after, err
+}
+
+// update stores the patchable fields of after over before, unless
+// they are the same.
+func update(tx *sql.Tx, before, after Manga) error {
+	if err := Normalize(&after); err != nil {
+		return err
+	}
+	if changed, _ := ChangedFields(before, after); len(changed) == 0 {
+		return nil
+	}
+
+	res, err := tx.Exec(`
+		UPDATE manga
+		SET title = ?, author = ?, genres = ?, status = ?, total_chapters = ?, description = ?,
+		    version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		after.Title, after.Author, encodeGenres(after.Genres), after.Status, after.TotalChapters, after.Description,
+		before.ID, before.Version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// announce tells readers about an edit that brought new chapters or a
+// new status; edits to the text alone are not news.
+func (c *Catalog) announce(before, after Manga) {
+	if after.Version == before.Version {
+		return
+	}
+	if after.TotalChapters > before.TotalChapters {
+		c.broadcast(chapterNews(after))
+	}
+	if after.Status != before.Status && after.Status != "" {
+		c.broadcast(statusNews(after))
+	}
+	catalogChanged()
+}
+
+// applyPatch merges patch into m. Only patchable fields may appear;
+// null clears a field.
+func applyPatch(m Manga, patch []byte) (Manga, error) {
+	var p map[string]any
+	if err := json.Unmarshal(patch, &p); err != nil || p == nil {
+		return m, InvalidError("patch must be a JSON object")
+	}
+	for k := range p {
+		if !slices.Contains(patchable, k) {
+			return m, invalid("%s cannot be changed; patchable fields are %s", k, strings.Join(patchable, ", "))
+		}
+	}
+
+	// a removed key unmarshals to the zero value, so null clears
+	var doc map[string]any
+	b, _ := json.Marshal(m)
+	json.Unmarshal(b, &doc)
+	doc = mergePatch(doc, p).(map[string]any)
+
+	var out Manga
+	b, _ = json.Marshal(doc)
+	if err := json.Unmarshal(b, &out); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return m, invalid("%s must be a %s", typeErr.Field, jsonType(typeErr.Type.Kind().String()))
+		}
+		return m, InvalidError(err.Error())
+	}
+	// not patchable, carried over as they are
+	out.ID, out.Score, out.VoteCount, out.Version = m.ID, m.Score, m.VoteCount, m.Version
+	return out, nil
+}
+
+// mergePatch is RFC 7396: objects merge key by key, null removes a
+// key and anything else replaces the target.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+func jsonType(kind string) string {
+	switch kind {
+	case "slice":
+		return "list"
+	case "int", "int64", "float64":
+		return "number"
+	}
+	return kind
+}
+
+// ChangedFields returns the patchable fields that differ between a and
+// b, as they were and as they are.
+func ChangedFields(a, b Manga) (before, after map[string]any) {
+	before, after = map[string]any{}, map[string]any{}
+	add := func(name string, x, y any) {
+		if x != y {
+			before[name], after[name] = x, y
+		}
+	}
+	add("title", a.Title, b.Title)
+	add("author", a.Author, b.Author)
+	if !slices.Equal(a.Genres, b.Genres) {
+		before["genres"], after["genres"] = a.Genres, b.Genres
+	}
+	add("status", a.Status, b.Status)
+	add("total_chapters", a.TotalChapters, b.TotalChapters)
+	add("description", a.Description, b.Description)
+	return before, after
+}
@@ -0,0 +1,208 @@
+package manga
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"mangahub/internal/review"
+)
+
+// Every write to a manga row goes through change, which stores it as a
+// revision: the fields it changed, from what to what, who changed them
+// and the manga as it was afterwards. Reverting writes an older
+// revision's fields back as a new revision, so the history is only
+// ever added to until the manga is purged.
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Editor is who made a change: an admin, or a tool such as an importer
+// that only has a name.
+type Editor struct {
+	ID   string
+	Name string
+}
+
+// Change is one field of a revision, as it was and as it became.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type Revision struct {
+	ID        int64             `json:"id"`
+	MangaID   string            `json:"manga_id"`
+	Version   int               `json:"version"` // of the manga after this change
+	Action    string            `json:"action"`
+	EditorID  string            `json:"editor_id,omitempty"`
+	Editor    string            `json:"editor"`
+	Changes   map[string]Change `json:"changes"`
+	RevertOf  int64             `json:"revert_of,omitempty"` // revision whose fields were restored
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// snapshot is what a revision keeps of the manga: the fields a revert
+// can put back.
+type snapshot struct {
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	Genres        []string `json:"genres"`
+	Status        string   `json:"status"`
+	TotalChapters int      `json:"total_chapters"`
+	Description   string   `json:"description"`
+}
+
+func snapshotOf(m Manga) snapshot {
+	return snapshot{m.Title, m.Author, m.Genres, m.Status, m.TotalChapters, m.Description}
+}
+
+// apply returns m with the fields of s.
+func (s snapshot) apply(m Manga) Manga {
+	m.Title, m.Author, m.Genres, m.Status = s.Title, s.Author, s.Genres, s.Status
+	m.TotalChapters, m.Description = s.TotalChapters, s.Description
+	return m
+}
+
+// change runs write against the manga id in one transaction and, when
+// write moved the version on, stores the difference as a revision.
+// before is the zero Manga if there is no row yet. Both are read inside
+// the transaction; on error, before is returned for both.
+func (c *Catalog) change(id, action string, by Editor, revertOf int64, write func(tx *sql.Tx, before Manga) error) (before, after Manga, err error) {
+	mean := review.GlobalMean(c.db)
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return before, before, err
+	}
+	defer tx.Rollback()
+
+	load := func() (Manga, error) {
+		m, err := scanManga(tx.QueryRow(selectAnyManga+"WHERE m.id = ?", id), mean)
+		if err == sql.ErrNoRows {
+			return Manga{}, nil
+		}
+		return m, err
+	}
+
+	if before, err = load(); err != nil {
+		return before, before, err
+	}
+	if err := write(tx, before); err != nil {
+		return before, before, err
+	}
+	if after, err = load(); err != nil {
+		return before, before, err
+	}
+	if after.Version == before.Version {
+		return before, after, nil // nothing was written
+	}
+
+	if err := recordRevision(tx, action, by, revertOf, before, after); err != nil {
+		return before, before, err
+	}
+	if err := tx.Commit(); err != nil {
+		return before, before, err
+	}
+	return before, after, nil
+}
+
+func recordRevision(tx *sql.Tx, action string, by Editor, revertOf int64, before, after Manga) error {
+	from, to := ChangedFields(before, after)
+	changes := make(map[string]Change, len(to)+1)
+	for field := range to {
+		changes[field] = Change{from[field], to[field]}
+	}
+	if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+		changes["deleted_at"] = Change{before.DeletedAt, after.DeletedAt}
+	}
+
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	snap, err := json.Marshal(snapshotOf(after))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO manga_revisions (manga_id, version, action, editor_id, editor_name, changes, snapshot, revert_of, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, after.ID, after.Version, action, by.ID, by.Name, string(diff), string(snap),
+		sql.NullInt64{Int64: revertOf, Valid: revertOf != 0}, time.Now().UTC())
+	return err
+}
+
+// Revisions lists the stored changes to the manga id, newest first; a
+// limit of 0 lists them all. Manga in the trash keep their history.
+func (c *Catalog) Revisions(id string, limit int) ([]Revision, error) {
+	var n int
+	c.db.QueryRow(`SELECT COUNT(*) FROM manga WHERE id = ?`, id).Scan(&n)
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+
+	rows, err := c.db.Query(`
+		SELECT id, manga_id, version, action, COALESCE(editor_id, ''), COALESCE(editor_name, ''),
+		       changes, COALESCE(revert_of, 0), created_at
+		FROM manga_revisions
+		WHERE manga_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Revision{}
+	for rows.Next() {
+		var r Revision
+		var changes string
+		if err := rows.Scan(&r.ID, &r.MangaID, &r.Version, &r.Action, &r.EditorID, &r.Editor,
+			&changes, &r.RevertOf, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(changes), &r.Changes)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// Revert puts the fields stored with revision back on the manga id, if
+// ifMatch still names its current version, and stores that as a new
+// revision. Reverting to what the manga already is stores nothing.
+//
+// On ErrVersionMismatch, before is the current manga.
+func (c *Catalog) Revert(id string, revision int64, ifMatch string, by Editor) (before, after Manga, err error) {
+	var data string
+	err = c.db.QueryRow(`
+		SELECT snapshot FROM manga_revisions WHERE id = ? AND manga_id = ?
+	`, revision, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return before, after, ErrRevisionNotFound
+	} else if err != nil {
+		return before, after, err
+	}
+	var s snapshot
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return before, after, err
+	}
+
+	before, after, err = c.change(id, "revert", by, revision, func(tx *sql.Tx, before Manga) error {
+		if before.ID == "" || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if !before.MatchesETag(ifMatch) {
+			return ErrVersionMismatch
+		}
+		return update(tx, before, s.apply(before))
+	})
+	if err == nil {
+		c.announce(before, after)
+	}
+	return before, after, err
+}
@@ -0,0 +1,205 @@
+package manga
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/comment"
+	"mangahub/internal/review"
+)
+
+// Deleting a manga moves it to the trash: it keeps its row, with
+// deleted_at set, and disappears from every read. Restoring it brings
+// it back as it was, progress and reviews included. After the trash
+// retention the purge removes it for good, archiving what readers had
+// for it and its revisions in manga_archive and deleting everything
+// else that hangs off the id.
+
+var ErrInTrash = errors.New("a manga with this id is in the trash; restore it instead")
+
+// Delete moves a manga to the trash and returns it as it was.
+func (c *Catalog) Delete(id string, by Editor) (Manga, error) {
+	before, _, err := c.change(id, "delete", by, 0, func(tx *sql.Tx, before Manga) error {
+		if before.ID == "" || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		_, err := tx.Exec(`
+			UPDATE manga SET deleted_at = ?, version = version + 1 WHERE id = ?
+		`, time.Now().UTC(), id)
+		return err
+	})
+	if err != nil {
+		return before, err
+	}
+	catalogChanged()
+	return before, nil
+}
+
+// Restore takes a manga out of the trash.
+func (c *Catalog) Restore(id string, by Editor) (Manga, error) {
+	_, after, err := c.change(id, "restore", by, 0, func(tx *sql.Tx, before Manga) error {
+		if before.DeletedAt == nil {
+			return ErrNotFound
+		}
+		_, err := tx.Exec(`
+			UPDATE manga SET deleted_at = NULL, version = version + 1 WHERE id = ?
+		`, id)
+		return err
+	})
+	if err != nil {
+		return after, err
+	}
+	catalogChanged()
+	return after, nil
+}
+
+// Trash lists the deleted manga, most recently deleted first.
+func (c *Catalog) Trash() ([]Manga, error) {
+	list, err := c.query(selectAnyManga + `WHERE m.deleted_at IS NOT NULL ORDER BY m.deleted_at DESC`)
+	if list == nil {
+		list = []Manga{}
+	}
+	return list, err
+}
+
+// archived is what manga_archive keeps of a purged manga.
+type archived struct {
+	Manga     Manga           `json:"manga"`
+	Progress  []progressEntry `json:"progress"`
+	Reviews   []review.Review `json:"reviews"`
+	Revisions []Revision      `json:"revisions"`
+}
+
+type progressEntry struct {
+	UserID         string `json:"user_id"`
+	CurrentChapter int    `json:"current_chapter"`
+	Status         string `json:"status"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// Purge removes the manga that have been in the trash longer than
+// c.Retention and returns how many it removed.
+func (c *Catalog) Purge() (int, error) {
+	rows, err := c.db.Query(`
+		SELECT id FROM manga WHERE deleted_at IS NOT NULL AND deleted_at < ?
+	`, time.Now().UTC().Add(-c.Retention))
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	purged := 0
+	for _, id := range ids {
+		if err := c.purge(id); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge removes one manga from the trash, with everything that refers
+// to it, in one transaction.
+func (c *Catalog) purge(id string) error {
+	m, err := scanManga(c.db.QueryRow(selectAnyManga+"WHERE m.id = ? AND m.deleted_at IS NOT NULL", id), review.GlobalMean(c.db))
+	if err == sql.ErrNoRows {
+		return nil // restored in the meantime
+	}
+	if err != nil {
+		return err
+	}
+
+	history, err := c.Revisions(id, 0)
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	a := archived{Manga: m, Progress: []progressEntry{}, Revisions: history}
+	rows, err := tx.Query(`
+		SELECT user_id, COALESCE(current_chapter, 0), COALESCE(status, ''), COALESCE(updated_at, '')
+		FROM user_progress WHERE manga_id = ?
+	`, id)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var p progressEntry
+		if err := rows.Scan(&p.UserID, &p.CurrentChapter, &p.Status, &p.UpdatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		a.Progress = append(a.Progress, p)
+	}
+	rows.Close()
+
+	if a.Reviews, err = review.PurgeManga(tx, id); err != nil {
+		return err
+	}
+	if err := comment.PurgeManga(tx, id); err != nil {
+		return err
+	}
+
+	data, _ := json.Marshal(a)
+	if _, err := tx.Exec(`
+		INSERT INTO manga_archive (manga_id, title, data, deleted_at, purged_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, m.Title, string(data), m.DeletedAt, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	// collection_items go with the manga row (ON DELETE CASCADE)
+	for _, stmt := range []string{
+		`DELETE FROM user_progress WHERE manga_id = ?`,
+		`DELETE FROM manga_activity WHERE manga_id = ?`,
+		`DELETE FROM manga_similar WHERE manga_id = ?1 OR similar_id = ?1`,
+		`DELETE FROM manga_revisions WHERE manga_id = ?`,
+		`DELETE FROM manga WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	audit.Record(c.db, audit.Entry{
+		ActorName:  "system",
+		Action:     "manga.purge",
+		TargetType: "manga",
+		TargetID:   id,
+		Before:     map[string]any{"title": m.Title, "progress": len(a.Progress), "reviews": len(a.Reviews)},
+	})
+	return nil
+}
+
+// StartPurge purges the trash every interval.
+func (c *Catalog) StartPurge(interval time.Duration) {
+	go func() {
+		for {
+			n, err := c.Purge()
+			if err != nil {
+				log.Println("manga: trash purge:", err)
+			} else if n > 0 {
+				log.Printf("manga: purged %d manga from the trash", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,198 @@
+// Package ratelimit hands out requests from token buckets. A bucket
+// holds up to Burst tokens and refills at Requests per Per; every
+// request takes one token and is refused when none is left.
+//
+// Buckets live behind the Limiter interface: Memory keeps them in the
+// process, SQLStore in a SQLite file so several servers share them.
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit is one rate. A Limit with no Requests does not limit anything.
+type Limit struct {
+	Requests int           `json:"requests"`
+	Per      time.Duration `json:"per"`
+	Burst    int           `json:"burst"` // defaults to Requests
+}
+
+// PerMinute is n requests a minute, all of which may come at once.
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Per: time.Minute}
+}
+
+// UnmarshalJSON reads per as a duration string, e.g. "1m" or "10s".
+func (l *Limit) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Requests int    `json:"requests"`
+		Per      string `json:"per"`
+		Burst    int    `json:"burst"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	l.Requests, l.Burst, l.Per = raw.Requests, raw.Burst, time.Minute
+	if raw.Per != "" {
+		d, err := time.ParseDuration(raw.Per)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("per %q is not a duration", raw.Per)
+		}
+		l.Per = d
+	}
+	return nil
+}
+
+func (l Limit) enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate is the refill in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // whole tokens left
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when refused
+}
+
+// Headers are the X-RateLimit-* headers for r, plus Retry-After when
+// the request was refused. Times are whole seconds, rounded up. There
+// are none when no limit applied.
+func (r Result) Headers() map[string]string {
+	if r.Limit == 0 {
+		return nil
+	}
+	h := map[string]string{
+		"X-RateLimit-Limit":     strconv.Itoa(r.Limit),
+		"X-RateLimit-Remaining": strconv.Itoa(r.Remaining),
+		"X-RateLimit-Reset":     strconv.Itoa(seconds(r.Reset)),
+	}
+	if !r.Allowed {
+		h["Retry-After"] = strconv.Itoa(r.RetrySeconds())
+	}
+	return h
+}
+
+// SetHeaders writes r's headers to an HTTP response.
+func (r Result) SetHeaders(h http.Header) {
+	for k, v := range r.Headers() {
+		h.Set(k, v)
+	}
+}
+
+// RetrySeconds is RetryAfter in whole seconds, rounded up.
+func (r Result) RetrySeconds() int {
+	return seconds(r.RetryAfter)
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Limiter takes a token from the bucket named key, creating it full
+// if it does not exist yet.
+type Limiter interface {
+	Take(key string, l Limit) (Result, error)
+}
+
+// bucket is the state every Limiter keeps per key.
+type bucket struct {
+	tokens float64
+	at     time.Time // when tokens was last worked out
+}
+
+// take refills b up to now and takes a token if there is one.
+func (b *bucket) take(l Limit, now time.Time) Result {
+	size := float64(l.burst())
+	if b.at.IsZero() {
+		b.tokens = size
+	} else if elapsed := now.Sub(b.at).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(size, b.tokens+elapsed*l.rate())
+	}
+	b.at = now
+
+	r := Result{Limit: l.burst()}
+	if b.tokens >= 1 {
+		b.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = duration((1 - b.tokens) / l.rate())
+	}
+	r.Remaining = int(b.tokens)
+	r.Reset = duration((size - b.tokens) / l.rate())
+	return r
+}
+
+// full is when an unused bucket is back to full, after which it is the
+// same as no bucket and can be dropped.
+func (b *bucket) full(l Limit) time.Time {
+	return b.at.Add(duration((float64(l.burst()) - b.tokens) / l.rate()))
+}
+
+func duration(secs float64) time.Duration {
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Memory keeps buckets in this process. Full buckets are dropped, so
+// memory follows the number of recent callers, not all callers ever.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memBucket
+}
+
+type memBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+func NewMemory() *Memory {
+	m := &Memory{buckets: make(map[string]*memBucket)}
+	go m.sweep(time.Minute)
+	return m
+}
+
+func (m *Memory) Take(key string, l Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.buckets[key]
+	if b == nil {
+		b = &memBucket{}
+		m.buckets[key] = b
+	}
+	r := b.take(l, time.Now())
+	b.fullAt = b.full(l)
+	return r, nil
+}
+
+func (m *Memory) sweep(every time.Duration) {
+	for range time.Tick(every) {
+		now := time.Now()
+		m.mu.Lock()
+		for key, b := range m.buckets {
+			if now.After(b.fullAt) {
+				delete(m.buckets, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Subject is who a bucket belongs to: an API key, a signed-in user or,
+// for anonymous callers, an IP address.
+type Subject struct {
+	Kind string // "key", "user" or "ip"
+	ID   string
+}
+
+func APIKey(id string) Subject { return Subject{"key", id} }
+func User(id string) Subject   { return Subject{"user", id} }
+func IP(ip string) Subject     { return Subject{"ip", ip} }
+
+func (s Subject) String() string {
+	return s.Kind + ":" + s.ID
+}
+
+// RouteLimit is an extra limit for some requests, counted per subject
+// on top of the subject's own limit.
+//
+// Route is "[METHOD ]PATH". HTTP requests are "GET /manga/1", gRPC
+// calls "GRPC /manga.MangaService/SearchManga", TCP and UDP messages
+// "TCP PROGRESS" and "UDP REGISTER". A PATH ending in * matches every
+// path that starts with the rest; without METHOD any method matches.
+type RouteLimit struct {
+	Route string `json:"route"`
+	Limit
+}
+
+func (rl *RouteLimit) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Route string `json:"route"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	rl.Route = raw.Route
+	return rl.Limit.UnmarshalJSON(b)
+}
+
+func (rl RouteLimit) matches(route string) bool {
+	method, path := splitRoute(rl.Route)
+	m, p := splitRoute(route)
+	if method != "" && method != m {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(path, "*"); ok {
+		return strings.HasPrefix(p, prefix)
+	}
+	return p == path
+}
+
+func splitRoute(route string) (method, path string) {
+	if i := strings.IndexByte(route, ' '); i >= 0 {
+		return route[:i], route[i+1:]
+	}
+	return "", route
+}
+
+// Policy says how much each subject may do. Users and APIKeys override
+// User and APIKey for single accounts and keys, by id.
+type Policy struct {
+	IP     Limit        `json:"ip"`
+	User   Limit        `json:"user"`
+	APIKey Limit        `json:"api_key"`
+	Routes []RouteLimit `json:"routes"`
+
+	Users   map[string]Limit `json:"users"`
+	APIKeys map[string]Limit `json:"api_keys"`
+}
+
+// DefaultPolicy is used without a RATE_LIMITS file: 100 requests a
+// minute for everyone and 10 for login and registration.
+func DefaultPolicy() Policy {
+	return Policy{
+		IP:     PerMinute(100),
+		User:   PerMinute(100),
+		APIKey: PerMinute(100),
+		Routes: []RouteLimit{
+			{Route: "/auth/*", Limit: PerMinute(10)},
+			{Route: "TCP *", Limit: Limit{Requests: 60, Per: time.Minute, Burst: 20}},
+			{Route: "UDP *", Limit: PerMinute(30)},
+		},
+	}
+}
+
+func (p *Policy) limitFor(s Subject) Limit {
+	switch s.Kind {
+	case "key":
+		if l, ok := p.APIKeys[s.ID]; ok {
+			return l
+		}
+		return p.APIKey
+	case "user":
+		if l, ok := p.Users[s.ID]; ok {
+			return l
+		}
+		return p.User
+	}
+	return p.IP
+}
+
+// Guard applies a Policy with a Limiter.
+type Guard struct {
+	Limiter Limiter
+	Policy  Policy
+}
+
+// Allow takes a token for s from every limit that applies to route.
+// The result is the refused limit if any, else the one with the fewest
+// tokens left. When the limiter fails the request is let through; a
+// broken store should not take the servers down with it.
+func (g *Guard) Allow(s Subject, route string) Result {
+	var tightest *Result
+
+	check := func(key string, l Limit) bool {
+		if !l.enabled() {
+			return true
+		}
+		r, err := g.Limiter.Take(key, l)
+		if err != nil {
+			log.Println("ratelimit:", err)
+			return true
+		}
+		if tightest == nil || !r.Allowed || r.Remaining < tightest.Remaining {
+			tightest = &r
+		}
+		return r.Allowed
+	}
+
+	for _, rl := range g.Policy.Routes {
+		if rl.matches(route) && !check("route:"+rl.Route+"|"+s.String(), rl.Limit) {
+			return *tightest
+		}
+	}
+	check(s.String(), g.Policy.limitFor(s))
+
+	if tightest == nil {
+		return Result{Allowed: true}
+	}
+	return *tightest
+}
+
+// FromEnv builds the guard every server uses. RATE_LIMITS names a JSON
+// Policy file; its fields replace the defaults. RATE_LIMIT_DB names a
+// SQLite file for the buckets, so servers sharing it share limits;
+// without it buckets are kept in memory.
+func FromEnv() (*Guard, error) {
+	g := &Guard{Policy: DefaultPolicy()}
+
+	if path := os.Getenv("RATE_LIMITS"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &g.Policy); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if path := os.Getenv("RATE_LIMIT_DB"); path != "" {
+		store, err := OpenSQLStore(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		g.Limiter = store
+	} else {
+		g.Limiter = NewMemory()
+	}
+	return g, nil
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLStore keeps buckets in a SQLite file, so the API, gRPC, TCP and
+// UDP servers can share one budget per caller. Each Take is a write
+// transaction; the file can be the main database or a separate one.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// OpenSQLStore opens (or creates) the bucket table in the SQLite file
+// at path.
+func OpenSQLStore(path string) (*SQLStore, error) {
+	// immediate transactions take the write lock up front, so two
+	// processes never both read the same token count
+	db, err := sql.Open("sqlite3", path+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			key TEXT PRIMARY KEY,
+			tokens REAL NOT NULL,
+			updated_at INTEGER NOT NULL,
+			full_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SQLStore{db: db}
+	go s.sweep(5 * time.Minute)
+	return s, nil
+}
+
+func (s *SQLStore) Take(key string, l Limit) (Result, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	var b bucket
+	var at int64
+	err = tx.QueryRow(`SELECT tokens, updated_at FROM rate_limits WHERE key = ?`, key).Scan(&b.tokens, &at)
+	if err != nil && err != sql.ErrNoRows {
+		return Result{}, err
+	}
+	if err == nil {
+		b.at = time.Unix(0, at)
+	}
+
+	r := b.take(l, time.Now())
+	if _, err := tx.Exec(`
+		INSERT INTO rate_limits (key, tokens, updated_at, full_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			tokens = excluded.tokens, updated_at = excluded.updated_at, full_at = excluded.full_at
+	`, key, b.tokens, b.at.UnixNano(), b.full(l).UnixNano()); err != nil {
+		return Result{}, err
+	}
+	return r, tx.Commit()
+}
+
+// sweep drops buckets that have refilled; a missing bucket is a full one.
+func (s *SQLStore) sweep(every time.Duration) {
+	for range time.Tick(every) {
+		s.db.Exec(`DELETE FROM rate_limits WHERE full_at < ?`, time.Now().UnixNano())
+	}
+}
@@ -0,0 +1,310 @@
+package recommend
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recommendation is one suggested manga with the reason it was picked.
+type Recommendation struct {
+	MangaID   string  `json:"manga_id"`
+	Title     string  `json:"title"`
+	Author    string  `json:"author"`
+	Status    string  `json:"status"`
+	Score     float64 `json:"score"`
+	BecauseOf string  `json:"because_of"`
+	Reason    string  `json:"reason"`
+}
+
+// Engine serves content-based recommendations from an in-memory model
+// of the catalog. The model is rebuilt in the background whenever the
+// catalog changes.
+type Engine struct {
+	db *sql.DB
+
+	mu          sync.RWMutex
+	model       *model
+	fingerprint string
+
+	buildMu sync.Mutex
+	dirty   chan struct{}
+}
+
+func NewEngine(db *sql.DB) *Engine {
+	return &Engine{
+		db:    db,
+		dirty: make(chan struct{}, 1),
+	}
+}
+
+// Start builds the first model and keeps it fresh. Changes made through
+// Invalidate are picked up at once; writes from other processes (such
+// as cmd/import-json) are caught by polling a catalog fingerprint.
+func (e *Engine) Start(interval time.Duration) {
+	go func() {
+		e.rebuild()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.dirty:
+				e.rebuild()
+			case <-ticker.C:
+				if e.currentFingerprint() != e.loadedFingerprint() {
+					e.rebuild()
+				}
+			}
+		}
+	}()
+}
+
+// Invalidate asks for a rebuild. It never blocks.
+func (e *Engine) Invalidate() {
+	select {
+	case e.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) rebuild() {
+	if _, err := e.snapshot(true); err != nil {
+		log.Println("recommend: rebuild failed:", err)
+	}
+}
+
+// snapshot returns the current model, building it first when there is
+// none yet or force is set.
+func (e *Engine) snapshot(force bool) (*model, error) {
+	if !force {
+		e.mu.RLock()
+		m := e.model
+		e.mu.RUnlock()
+		if m != nil {
+			return m, nil
+		}
+	}
+
+	e.buildMu.Lock()
+	defer e.buildMu.Unlock()
+
+	if !force {
+		e.mu.RLock()
+		m := e.model
+		e.mu.RUnlock()
+		if m != nil {
+			return m, nil
+		}
+	}
+
+	fp := e.currentFingerprint()
+	start := time.Now()
+	m, err := buildModel(e.db)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.model = m
+	e.fingerprint = fp
+	e.mu.Unlock()
+
+	log.Printf("recommend: model built with %d titles in %s", len(m.items), time.Since(start).Round(time.Millisecond))
+	return m, nil
+}
+
+func (e *Engine) loadedFingerprint() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.fingerprint
+}
+
+// currentFingerprint is cheap enough to poll: one pass over manga
+// without reading the text itself. Every catalog write bumps a title's
+// version, which catches edits that keep the lengths the same.
+func (e *Engine) currentFingerprint() string {
+	var count, size, versions int64
+	e.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(
+			LENGTH(id) + LENGTH(COALESCE(title, '')) + LENGTH(COALESCE(author, '')) +
+			LENGTH(COALESCE(genres, '')) + LENGTH(COALESCE(description, ''))
+		), 0), COALESCE(SUM(version), 0)
+		FROM manga
+		WHERE deleted_at IS NULL
+	`).Scan(&count, &size, &versions)
+	return fmt.Sprintf("%d:%d:%d", count, size, versions)
+}
+
+// libraryEntry is a title in the user's library and how much it should
+// pull the recommendations towards itself.
+type libraryEntry struct {
+	id     string
+	weight float64
+}
+
+func (e *Engine) library(userID string) ([]libraryEntry, map[string]bool, error) {
+	rows, err := e.db.Query(`
+		SELECT p.manga_id, COALESCE(p.status, 'reading'), COALESCE(r.score, 0)
+		FROM user_progress p
+		LEFT JOIN ratings r ON r.user_id = p.user_id AND r.manga_id = p.manga_id
+		WHERE p.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var seeds []libraryEntry
+	owned := make(map[string]bool)
+	for rows.Next() {
+		var id, status string
+		var score int
+		if err := rows.Scan(&id, &status, &score); err != nil {
+			return nil, nil, err
+		}
+		owned[id] = true
+
+		// a rating says more than a status: 6-10 pulls similar titles
+		// up and 1-4 pushes them down; a 5 says nothing either way, so
+		// the status decides
+		w := statusWeight(status)
+		if r := float64(score-5) / 5; score > 0 && r != 0 {
+			w = r
+		}
+		if w != 0 {
+			seeds = append(seeds, libraryEntry{id: id, weight: w})
+		}
+	}
+	return seeds, owned, rows.Err()
+}
+
+func statusWeight(status string) float64 {
+	switch status {
+	case "completed":
+		return 1
+	case "reading":
+		return 0.8
+	case "on_hold":
+		return 0.4
+	case "plan_to_read":
+		return 0.3
+	}
+	return 0 // dropped
+}
+
+// Recommend returns up to limit titles similar to the user's library,
+// excluding titles already in it.
+func (e *Engine) Recommend(userID string, limit int) ([]Recommendation, error) {
+	m, err := e.snapshot(false)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds, owned, err := e.library(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		score    float64
+		best     float64
+		seed     *item
+		evidence similarity
+	}
+	candidates := make(map[string]*candidate)
+
+	for _, s := range seeds {
+		seed := m.byID[s.id]
+		if seed == nil {
+			continue
+		}
+		for _, it := range m.items {
+			if owned[it.id] {
+				continue
+			}
+			sim := itemSimilarity(seed, it)
+			if sim.score <= 0 {
+				continue
+			}
+
+			contrib := s.weight * sim.score
+			c := candidates[it.id]
+			if c == nil {
+				c = &candidate{}
+				candidates[it.id] = c
+			}
+			c.score += contrib
+			if contrib > c.best {
+				c.best, c.seed, c.evidence = contrib, seed, sim
+			}
+		}
+	}
+
+	list := make([]Recommendation, 0, len(candidates))
+	for id, c := range candidates {
+		// only liked seeds explain a pick; titles that disliked ones
+		// outweigh are dropped
+		if c.seed == nil || c.score <= 0 {
+			continue
+		}
+		it := m.byID[id]
+		list = append(list, Recommendation{
+			MangaID:   id,
+			Title:     it.title,
+			Author:    it.byline,
+			Status:    it.status,
+			Score:     c.score,
+			BecauseOf: c.seed.id,
+			Reason:    explain(c.seed, c.evidence),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].MangaID < list[j].MangaID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	// normalise so the best match is 1
+	if len(list) > 0 && list[0].Score > 0 {
+		top := list[0].Score
+		for i := range list {
+			list[i].Score = float64(int(list[i].Score/top*1000)) / 1000
+		}
+	}
+	return list, nil
+}
+
+func explain(seed *item, sim similarity) string {
+	reason := "because you read " + seed.title
+	if why := contentReason(sim); why != "" {
+		reason += " (" + why + ")"
+	}
+	return reason
+}
+
+// contentReason names the strongest shared trait, or "" when only the
+// descriptions are alike.
+func contentReason(sim similarity) string {
+	switch {
+	case sim.sameAuthor:
+		return "same author"
+	case len(sim.sharedGenres) > 0:
+		genres := sim.sharedGenres
+		if len(genres) > 3 {
+			genres = genres[:3]
+		}
+		return strings.Join(genres, ", ")
+	}
+	return ""
+}
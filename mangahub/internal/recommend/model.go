@@ -0,0 +1,199 @@
+package recommend
+
+import (
+	"database/sql"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"mangahub/internal/manga"
+)
+
+// Weights of the three signals in itemSimilarity. They add up to 1.
+const (
+	genreWeight  = 0.45
+	authorWeight = 0.15
+	textWeight   = 0.40
+)
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	sourceNote = regexp.MustCompile(`(?i)\(source:[^)]*\)`)
+)
+
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"his": true, "her": true, "she": true, "him": true, "they": true, "their": true,
+	"from": true, "are": true, "was": true, "were": true, "has": true, "have": true,
+	"had": true, "but": true, "not": true, "all": true, "one": true, "who": true,
+	"what": true, "when": true, "where": true, "which": true, "into": true, "its": true,
+	"out": true, "can": true, "will": true, "just": true, "been": true, "about": true,
+	"more": true, "than": true, "them": true, "then": true, "there": true, "these": true,
+	"after": true, "only": true, "also": true, "now": true, "even": true, "each": true,
+	"other": true, "over": true, "while": true, "you": true, "your": true, "our": true,
+	"how": true, "why": true, "would": true, "could": true, "should": true, "does": true,
+}
+
+// item is one manga as the model sees it.
+type item struct {
+	id     string
+	title  string
+	byline string // author as stored
+	author string // lower case, for matching
+	status string
+	genres map[string]string  // lower case -> display name
+	vector map[string]float64 // L2-normalised TF-IDF of the description
+}
+
+// model is an immutable snapshot of the catalog.
+type model struct {
+	items []*item
+	byID  map[string]*item
+}
+
+func buildModel(db *sql.DB) (*model, error) {
+	rows, err := db.Query(`SELECT id, title, author, status, genres, description FROM manga WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := &model{byID: make(map[string]*item)}
+	var docs [][]string
+
+	for rows.Next() {
+		var id string
+		var title, author, status, genres, desc sql.NullString
+		if err := rows.Scan(&id, &title, &author, &status, &genres, &desc); err != nil {
+			return nil, err
+		}
+
+		it := &item{
+			id:     id,
+			title:  title.String,
+			byline: author.String,
+			author: strings.ToLower(strings.TrimSpace(author.String)),
+			status: status.String,
+			genres: make(map[string]string),
+		}
+		for _, g := range manga.DecodeGenres(genres.String) {
+			it.genres[strings.ToLower(g)] = g
+		}
+
+		m.items = append(m.items, it)
+		m.byID[id] = it
+		docs = append(docs, tokenize(desc.String))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// document frequency
+	df := make(map[string]int)
+	for _, doc := range docs {
+		seen := make(map[string]bool)
+		for _, t := range doc {
+			if !seen[t] {
+				seen[t] = true
+				df[t]++
+			}
+		}
+	}
+
+	n := float64(len(docs))
+	for i, doc := range docs {
+		m.items[i].vector = tfidf(doc, df, n)
+	}
+	return m, nil
+}
+
+func tfidf(doc []string, df map[string]int, n float64) map[string]float64 {
+	tf := make(map[string]float64)
+	for _, t := range doc {
+		tf[t]++
+	}
+
+	vec := make(map[string]float64, len(tf))
+	var norm float64
+	for t, count := range tf {
+		// terms in a single description, or in most of them, say
+		// nothing about similarity
+		if df[t] < 2 || float64(df[t]) > n/2 {
+			continue
+		}
+		w := (count / float64(len(doc))) * math.Log(n/float64(df[t]))
+		vec[t] = w
+		norm += w * w
+	}
+
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for t := range vec {
+		vec[t] /= norm
+	}
+	return vec
+}
+
+func tokenize(text string) []string {
+	text = htmlTag.ReplaceAllString(text, " ")
+	text = sourceNote.ReplaceAllString(text, " ")
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	tokens := words[:0]
+	for _, w := range words {
+		if len(w) >= 3 && !stopwords[w] {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	var dot float64
+	for t, w := range a {
+		dot += w * b[t]
+	}
+	return dot
+}
+
+// similarity describes how close two items are and why.
+type similarity struct {
+	score        float64
+	sameAuthor   bool
+	sharedGenres []string
+}
+
+func itemSimilarity(a, b *item) similarity {
+	var s similarity
+
+	if len(a.genres) > 0 && len(b.genres) > 0 {
+		union := len(a.genres)
+		for g, name := range b.genres {
+			if _, ok := a.genres[g]; ok {
+				s.sharedGenres = append(s.sharedGenres, name)
+			} else {
+				union++
+			}
+		}
+		sort.Strings(s.sharedGenres)
+		s.score += genreWeight * float64(len(s.sharedGenres)) / float64(union)
+	}
+
+	if a.author != "" && a.author == b.author {
+		s.sameAuthor = true
+		s.score += authorWeight
+	}
+
+	s.score += textWeight * cosine(a.vector, b.vector)
+	return s
+}
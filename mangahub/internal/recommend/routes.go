@@ -0,0 +1,59 @@
+package recommend
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes = personal recommendations, needs a logged in user
+func RegisterRoutes(r gin.IRouter, engine *Engine) {
+
+	// ---------------------------
+	// GET /users/recommendations?limit=
+	// ---------------------------
+	r.GET("/users/recommendations", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if limit <= 0 || limit > 50 {
+			limit = 10
+		}
+
+		list, err := engine.Recommend(userID, limit)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"recommendations": list})
+	})
+}
+
+// RegisterPublicRoutes = "readers also read", no login needed
+func RegisterPublicRoutes(r gin.IRouter, engine *Engine) {
+
+	// ---------------------------
+	// GET /manga/:id/similar?limit=
+	// ---------------------------
+	r.GET("/manga/:id/similar", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if limit <= 0 || limit > 50 {
+			limit = 10
+		}
+
+		list, err := engine.Similar(c.Param("id"), limit)
+		if err == ErrNotFound {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"similar": list})
+	})
+}
@@ -0,0 +1,243 @@
+package recommend
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// pairs read together by fewer users than this are noise
+	minCoReaders = 2
+	// neighbours kept per title in manga_similar
+	maxNeighbours = 30
+	// with this many readers a title gets half its ranking from
+	// co-reading and half from content; fewer leans on content
+	coldStartReaders = 5
+)
+
+var ErrNotFound = errors.New("manga not found")
+
+// Similar is one "readers also read" neighbour of a title.
+type Similar struct {
+	MangaID   string  `json:"manga_id"`
+	Title     string  `json:"title"`
+	Author    string  `json:"author"`
+	Status    string  `json:"status"`
+	Score     float64 `json:"score"`
+	CoReaders int     `json:"co_readers"`
+	Reason    string  `json:"reason"`
+}
+
+// StartSimilarityJob recomputes manga_similar now and then every
+// interval.
+func (e *Engine) StartSimilarityJob(interval time.Duration) {
+	go func() {
+		for {
+			start := time.Now()
+			if n, err := ComputeSimilar(e.db); err != nil {
+				log.Println("recommend: similarity job failed:", err)
+			} else {
+				log.Printf("recommend: %d similar pairs computed in %s", n, time.Since(start).Round(time.Millisecond))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ComputeSimilar rebuilds manga_similar from user_progress. Two titles
+// are similar when the same users read them, scored by cosine over the
+// sets of readers: |A∩B| / sqrt(|A|·|B|). Dropped titles do not count.
+func ComputeSimilar(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT user_id, manga_id FROM user_progress
+		WHERE COALESCE(status, 'reading') != 'dropped'
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	readers := make(map[string]int)
+	co := make(map[[2]string]int)
+
+	var current string
+	var library []string
+	flush := func() {
+		for i := range library {
+			readers[library[i]]++
+			for j := i + 1; j < len(library); j++ {
+				a, b := library[i], library[j]
+				if a > b {
+					a, b = b, a
+				}
+				co[[2]string{a, b}]++
+			}
+		}
+		library = library[:0]
+	}
+
+	for rows.Next() {
+		var userID, mangaID string
+		if err := rows.Scan(&userID, &mangaID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if userID != current {
+			flush()
+			current = userID
+		}
+		library = append(library, mangaID)
+	}
+	flush()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	type neighbour struct {
+		id    string
+		score float64
+		co    int
+	}
+	byManga := make(map[string][]neighbour)
+	for pair, n := range co {
+		if n < minCoReaders {
+			continue
+		}
+		score := float64(n) / math.Sqrt(float64(readers[pair[0]]*readers[pair[1]]))
+		byManga[pair[0]] = append(byManga[pair[0]], neighbour{pair[1], score, n})
+		byManga[pair[1]] = append(byManga[pair[1]], neighbour{pair[0], score, n})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM manga_similar`); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO manga_similar (manga_id, similar_id, score, co_readers)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	total := 0
+	for id, list := range byManga {
+		sort.Slice(list, func(i, j int) bool { return list[i].score > list[j].score })
+		if len(list) > maxNeighbours {
+			list = list[:maxNeighbours]
+		}
+		for _, nb := range list {
+			if _, err := stmt.Exec(id, nb.id, nb.score, nb.co); err != nil {
+				return 0, err
+			}
+			total++
+		}
+	}
+	return total, tx.Commit()
+}
+
+// Similar returns titles read by the readers of mangaID, blended with
+// content similarity so titles with few readers still get neighbours.
+func (e *Engine) Similar(mangaID string, limit int) ([]Similar, error) {
+	m, err := e.snapshot(false)
+	if err != nil {
+		return nil, err
+	}
+	source := m.byID[mangaID]
+	if source == nil {
+		return nil, ErrNotFound
+	}
+
+	var readers int
+	e.db.QueryRow(`SELECT COUNT(*) FROM user_progress WHERE manga_id = ?`, mangaID).Scan(&readers)
+	alpha := float64(readers) / float64(readers+coldStartReaders)
+
+	type candidate struct {
+		cf, content float64
+		co          int
+		sim         similarity
+	}
+	candidates := make(map[string]*candidate)
+
+	rows, err := e.db.Query(`
+		SELECT similar_id, score, co_readers FROM manga_similar WHERE manga_id = ?
+	`, mangaID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var c candidate
+		if err := rows.Scan(&id, &c.cf, &c.co); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if it := m.byID[id]; it != nil {
+			c.sim = itemSimilarity(source, it)
+			c.content = c.sim.score
+			candidates[id] = &c
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// content neighbours fill in for cold-start titles
+	for _, it := range m.items {
+		if it.id == mangaID || candidates[it.id] != nil {
+			continue
+		}
+		sim := itemSimilarity(source, it)
+		if sim.score > 0 {
+			candidates[it.id] = &candidate{content: sim.score, sim: sim}
+		}
+	}
+
+	list := make([]Similar, 0, len(candidates))
+	for id, c := range candidates {
+		it := m.byID[id]
+		s := Similar{
+			MangaID:   id,
+			Title:     it.title,
+			Author:    it.byline,
+			Status:    it.status,
+			Score:     alpha*c.cf + (1-alpha)*c.content,
+			CoReaders: c.co,
+		}
+		switch why := contentReason(c.sim); {
+		case c.co > 0:
+			s.Reason = "readers also read"
+		case why != "":
+			s.Reason = "similar: " + why
+		default:
+			s.Reason = "similar story"
+		}
+		list = append(list, s)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].MangaID < list[j].MangaID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	for i := range list {
+		list[i].Score = math.Round(list[i].Score*1000) / 1000
+	}
+	return list, nil
+}
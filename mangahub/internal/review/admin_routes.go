@@ -0,0 +1,72 @@
+package review
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/auth"
+)
+
+func RegisterAdminRoutes(r *gin.RouterGroup, db *sql.DB) {
+	r = r.Group("", auth.RequirePermission(auth.PermReviewModerate))
+
+	// GET /admin/reviews?hidden=1
+	r.GET("/reviews", func(c *gin.Context) {
+		limit, offset := pageParams(c)
+
+		list, err := ListForModeration(db, c.Query("hidden") == "1", limit, offset)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, list)
+	})
+
+	// PUT /admin/reviews/:id/hide  {"hidden": true, "reason": "..."}
+	r.PUT("/reviews/:id/hide", func(c *gin.Context) {
+		var req struct {
+			Hidden bool   `json:"hidden"`
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+		if !req.Hidden {
+			req.Reason = ""
+		}
+
+		res, err := db.Exec(`
+			UPDATE reviews SET hidden = ?, hidden_reason = ? WHERE id = ?
+		`, req.Hidden, req.Reason, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(404, gin.H{"error": "review not found"})
+			return
+		}
+
+		if req.Hidden {
+			c.JSON(200, gin.H{"message": "review hidden"})
+		} else {
+			c.JSON(200, gin.H{"message": "review restored"})
+		}
+	})
+
+	r.DELETE("/reviews/:id", func(c *gin.Context) {
+		res, err := db.Exec(`DELETE FROM reviews WHERE id = ?`, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(404, gin.H{"error": "review not found"})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "review deleted"})
+	})
+}
@@ -0,0 +1,184 @@
+package review
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const maxBodyLength = 10000
+
+var ErrNotFound = errors.New("review not found")
+
+// Review is a user's written opinion on a manga.
+type Review struct {
+	ID           int64  `json:"id"`
+	MangaID      string `json:"manga_id"`
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	Rating       int    `json:"rating,omitempty"`
+	Body         string `json:"body"`
+	Spoiler      bool   `json:"spoiler"`
+	HelpfulCount int    `json:"helpful_count"`
+	Edited       bool   `json:"edited"`
+	Hidden       bool   `json:"hidden,omitempty"`
+	HiddenReason string `json:"hidden_reason,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// Revision is an earlier version of a review, kept on every edit.
+type Revision struct {
+	Body     string `json:"body"`
+	Spoiler  bool   `json:"spoiler"`
+	EditedAt string `json:"edited_at"`
+}
+
+const selectReview = `
+	SELECT r.id, r.manga_id, r.user_id, COALESCE(u.username, ''), COALESCE(rt.score, 0),
+	       r.body, r.spoiler, r.helpful_count,
+	       EXISTS (SELECT 1 FROM review_revisions v WHERE v.review_id = r.id),
+	       r.hidden, r.hidden_reason, r.created_at, r.updated_at
+	FROM reviews r
+	LEFT JOIN users u ON CAST(u.id AS TEXT) = r.user_id
+	LEFT JOIN ratings rt ON rt.user_id = r.user_id AND rt.manga_id = r.manga_id
+`
+
+func scanReview(row interface{ Scan(...any) error }) (*Review, error) {
+	var r Review
+	err := row.Scan(&r.ID, &r.MangaID, &r.UserID, &r.Username, &r.Rating,
+		&r.Body, &r.Spoiler, &r.HelpfulCount, &r.Edited,
+		&r.Hidden, &r.HiddenReason, &r.CreatedAt, &r.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func queryReviews(db *sql.DB, query string, args ...any) ([]Review, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Review{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+// Get loads review id, including hidden ones.
+func Get(db *sql.DB, id string) (*Review, error) {
+	return scanReview(db.QueryRow(selectReview+`WHERE r.id = ?`, id))
+}
+
+// ListForManga returns the visible reviews of mangaID, most helpful
+// first unless sort is "recent".
+func ListForManga(db *sql.DB, mangaID, sort string, limit, offset int) ([]Review, error) {
+	order := "r.helpful_count DESC, r.created_at DESC"
+	if sort == "recent" {
+		order = "r.created_at DESC"
+	}
+	return queryReviews(db, selectReview+`
+		WHERE r.manga_id = ? AND r.hidden = 0
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, mangaID, limit, offset)
+}
+
+// ListForModeration returns reviews for the admin queue.
+func ListForModeration(db *sql.DB, hiddenOnly bool, limit, offset int) ([]Review, error) {
+	return queryReviews(db, selectReview+`
+		WHERE (r.hidden = 1 OR NOT ?)
+		ORDER BY r.updated_at DESC
+		LIMIT ? OFFSET ?
+	`, hiddenOnly, limit, offset)
+}
+
+// History returns the earlier versions of review id, oldest first.
+func History(db *sql.DB, id int64) ([]Revision, error) {
+	rows, err := db.Query(`
+		SELECT body, spoiler, edited_at
+		FROM review_revisions
+		WHERE review_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Revision{}
+	for rows.Next() {
+		var v Revision
+		if err := rows.Scan(&v.Body, &v.Spoiler, &v.EditedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+// Edit replaces the body of r, keeping the old text as a revision.
+func Edit(db *sql.DB, r *Review, body string, spoiler bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO review_revisions (review_id, body, spoiler, edited_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, r.ID, r.Body, r.Spoiler); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE reviews SET body = ?, spoiler = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, body, spoiler, r.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Vote marks review id as helpful for userID, or removes that mark.
+// The count on the review is kept in step with review_votes.
+func Vote(db *sql.DB, id int64, userID string, helpful bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if helpful {
+		res, err = tx.Exec(`INSERT OR IGNORE INTO review_votes (review_id, user_id) VALUES (?, ?)`, id, userID)
+	} else {
+		res, err = tx.Exec(`DELETE FROM review_votes WHERE review_id = ? AND user_id = ?`, id, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		delta := 1
+		if !helpful {
+			delta = -1
+		}
+		if _, err := tx.Exec(`
+			UPDATE reviews SET helpful_count = helpful_count + ? WHERE id = ?
+		`, delta, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
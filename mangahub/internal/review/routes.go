@@ -0,0 +1,315 @@
+package review
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/trending"
+)
+
+// RegisterRoutes = rating and review writes for logged in users
+func RegisterRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// PUT /manga/:id/rating
+	// ---------------------------
+	r.PUT("/manga/:id/rating", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			Score int `json:"score"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		if req.Score < 1 || req.Score > 10 {
+			c.JSON(400, gin.H{"error": "score must be between 1 and 10"})
+			return
+		}
+
+		mangaID := c.Param("id")
+		if !mangaExists(db, mangaID) {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+
+		if err := Rate(db, userID, mangaID, req.Score); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		_ = trending.Record(db, mangaID, userID, trending.KindRating)
+
+		score, _ := GetScore(db, mangaID)
+		c.JSON(200, score)
+	})
+
+	// ---------------------------
+	// DELETE /manga/:id/rating
+	// ---------------------------
+	r.DELETE("/manga/:id/rating", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		mangaID := c.Param("id")
+		removed, err := Unrate(db, userID, mangaID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(404, gin.H{"error": "No rating to remove"})
+			return
+		}
+
+		score, _ := GetScore(db, mangaID)
+		c.JSON(200, score)
+	})
+
+	// ---------------------------
+	// POST /manga/:id/reviews
+	// ---------------------------
+	r.POST("/manga/:id/reviews", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			Body    string `json:"body"`
+			Spoiler bool   `json:"spoiler"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if msg := validateBody(req.Body); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		mangaID := c.Param("id")
+		if !mangaExists(db, mangaID) {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+
+		res, err := db.Exec(`
+			INSERT INTO reviews (user_id, manga_id, body, spoiler)
+			VALUES (?, ?, ?, ?)
+		`, userID, mangaID, req.Body, req.Spoiler)
+		if err != nil {
+			c.JSON(409, gin.H{"error": "You already reviewed this manga"})
+			return
+		}
+
+		id, _ := res.LastInsertId()
+		rev, err := Get(db, strconv.FormatInt(id, 10))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(201, rev)
+	})
+
+	// ---------------------------
+	// PUT /reviews/:id (edit own review)
+	// ---------------------------
+	r.PUT("/reviews/:id", func(c *gin.Context) {
+		rev, ok := ownReview(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Body    string `json:"body"`
+			Spoiler bool   `json:"spoiler"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if msg := validateBody(req.Body); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		if req.Body == rev.Body && req.Spoiler == rev.Spoiler {
+			c.JSON(200, rev)
+			return
+		}
+
+		if err := Edit(db, rev, req.Body, req.Spoiler); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, _ := Get(db, c.Param("id"))
+		c.JSON(200, updated)
+	})
+
+	// ---------------------------
+	// DELETE /reviews/:id (own review)
+	// ---------------------------
+	r.DELETE("/reviews/:id", func(c *gin.Context) {
+		rev, ok := ownReview(c, db)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM reviews WHERE id = ?`, rev.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"message": "Review deleted"})
+	})
+
+	// ---------------------------
+	// POST /reviews/:id/helpful
+	// DELETE /reviews/:id/helpful
+	// ---------------------------
+	vote := func(helpful bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			userID := c.GetString("user_id")
+			if userID == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+
+			rev, err := Get(db, c.Param("id"))
+			if err == ErrNotFound || (err == nil && rev.Hidden) {
+				c.JSON(404, gin.H{"error": "Not found"})
+				return
+			} else if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			if rev.UserID == userID {
+				c.JSON(400, gin.H{"error": "Cannot vote on your own review"})
+				return
+			}
+
+			if err := Vote(db, rev.ID, userID, helpful); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			updated, _ := Get(db, c.Param("id"))
+			c.JSON(200, gin.H{"helpful_count": updated.HelpfulCount})
+		}
+	}
+	r.POST("/reviews/:id/helpful", vote(true))
+	r.DELETE("/reviews/:id/helpful", vote(false))
+}
+
+// RegisterPublicRoutes = read-only review pages
+func RegisterPublicRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /manga/:id/reviews?sort=helpful|recent
+	// ---------------------------
+	r.GET("/manga/:id/reviews", func(c *gin.Context) {
+		limit, offset := pageParams(c)
+
+		if !mangaExists(db, c.Param("id")) {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+
+		list, err := ListForManga(db, c.Param("id"), c.Query("sort"), limit, offset)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		score, _ := GetScore(db, c.Param("id"))
+		c.JSON(200, gin.H{
+			"score":      score.Average,
+			"vote_count": score.Votes,
+			"reviews":    list,
+		})
+	})
+
+	// ---------------------------
+	// GET /reviews/:id/history
+	// ---------------------------
+	r.GET("/reviews/:id/history", func(c *gin.Context) {
+		rev, err := Get(db, c.Param("id"))
+		if err == ErrNotFound || (err == nil && rev.Hidden) {
+			c.JSON(404, gin.H{"error": "Not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		history, err := History(db, rev.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"review": rev, "revisions": history})
+	})
+}
+
+// ownReview loads :id if it belongs to the current user, writing the
+// error response itself when that fails.
+func ownReview(c *gin.Context, db *sql.DB) (*Review, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	rev, err := Get(db, c.Param("id"))
+	if err == ErrNotFound || (err == nil && rev.UserID != userID) {
+		c.JSON(404, gin.H{"error": "Not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return rev, true
+}
+
+func mangaExists(db *sql.DB, id string) bool {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM manga WHERE id = ? AND deleted_at IS NULL`, id).Scan(&n)
+	return n > 0
+}
+
+func validateBody(body string) string {
+	if body == "" {
+		return "Missing body"
+	}
+	if len(body) > maxBodyLength {
+		return "Review too long"
+	}
+	return ""
+}
+
+func pageParams(c *gin.Context) (int, int) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
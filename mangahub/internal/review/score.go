@@ -0,0 +1,183 @@
+package review
+
+import (
+	"database/sql"
+	"math"
+)
+
+// priorWeight is how many "average" votes every title starts with, so
+// a single 10/10 does not put an obscure title at the top.
+const priorWeight = 10
+
+// defaultMean is used as the prior before anyone has rated anything.
+const defaultMean = 5.5
+
+// Score is the public rating summary of a manga.
+type Score struct {
+	Average float64 `json:"score"`
+	Votes   int     `json:"vote_count"`
+}
+
+// GlobalMean returns the mean of every rating, read from the running
+// totals rather than aggregated from the ratings table.
+func GlobalMean(db *sql.DB) float64 {
+	var votes, sum int
+	err := db.QueryRow(`SELECT vote_count, score_sum FROM rating_totals WHERE id = 1`).Scan(&votes, &sum)
+	if err != nil || votes == 0 {
+		return defaultMean
+	}
+	return float64(sum) / float64(votes)
+}
+
+// Bayesian returns the weighted average for a title with votes ratings
+// summing to sum. Unrated titles score 0.
+func Bayesian(sum, votes int, mean float64) float64 {
+	if votes == 0 {
+		return 0
+	}
+	avg := (priorWeight*mean + float64(sum)) / float64(priorWeight+votes)
+	return math.Round(avg*100) / 100
+}
+
+// GetScore returns the score of a single manga.
+func GetScore(db *sql.DB, mangaID string) (Score, error) {
+	var votes, sum int
+	err := db.QueryRow(`
+		SELECT vote_count, score_sum FROM manga_scores WHERE manga_id = ?
+	`, mangaID).Scan(&votes, &sum)
+	if err == sql.ErrNoRows {
+		return Score{}, nil
+	}
+	if err != nil {
+		return Score{}, err
+	}
+	return Score{Average: Bayesian(sum, votes, GlobalMean(db)), Votes: votes}, nil
+}
+
+// Rate stores userID's score for mangaID and updates the running totals
+// by the difference to any previous score.
+func Rate(db *sql.DB, userID, mangaID string, score int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old int
+	err = tx.QueryRow(`
+		SELECT score FROM ratings WHERE user_id = ? AND manga_id = ?
+	`, userID, mangaID).Scan(&old)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	isNew := err == sql.ErrNoRows
+
+	if _, err := tx.Exec(`
+		INSERT INTO ratings (user_id, manga_id, score, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, manga_id)
+		DO UPDATE SET score = excluded.score, updated_at = excluded.updated_at
+	`, userID, mangaID, score); err != nil {
+		return err
+	}
+
+	votes := 0
+	if isNew {
+		votes = 1
+	}
+	if err := applyDelta(tx, mangaID, votes, score-old); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Unrate removes userID's score for mangaID. It reports false when there
+// was nothing to remove.
+func Unrate(db *sql.DB, userID, mangaID string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var old int
+	err = tx.QueryRow(`
+		SELECT score FROM ratings WHERE user_id = ? AND manga_id = ?
+	`, userID, mangaID).Scan(&old)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM ratings WHERE user_id = ? AND manga_id = ?`, userID, mangaID); err != nil {
+		return false, err
+	}
+	if err := applyDelta(tx, mangaID, -1, -old); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func applyDelta(tx *sql.Tx, mangaID string, votes, sum int) error {
+	if _, err := tx.Exec(`
+		INSERT INTO manga_scores (manga_id, vote_count, score_sum)
+		VALUES (?, ?, ?)
+		ON CONFLICT(manga_id) DO UPDATE SET
+			vote_count = vote_count + excluded.vote_count,
+			score_sum = score_sum + excluded.score_sum
+	`, mangaID, votes, sum); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE rating_totals
+		SET vote_count = vote_count + ?, score_sum = score_sum + ?
+		WHERE id = 1
+	`, votes, sum)
+	return err
+}
+
+// PurgeManga removes every review and rating of mangaID and takes its
+// ratings out of the global totals. It returns the reviews as they were,
+// for the caller to archive. Part of purging a manga from the trash.
+func PurgeManga(tx *sql.Tx, mangaID string) ([]Review, error) {
+	rows, err := tx.Query(selectReview+`WHERE r.manga_id = ? ORDER BY r.id`, mangaID)
+	if err != nil {
+		return nil, err
+	}
+	list := []Review{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var votes, sum int
+	tx.QueryRow(`SELECT vote_count, score_sum FROM manga_scores WHERE manga_id = ?`, mangaID).Scan(&votes, &sum)
+	if _, err := tx.Exec(`
+		UPDATE rating_totals
+		SET vote_count = vote_count - ?, score_sum = score_sum - ?
+		WHERE id = 1
+	`, votes, sum); err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM reviews WHERE manga_id = ?`,
+		`DELETE FROM ratings WHERE manga_id = ?`,
+		`DELETE FROM manga_scores WHERE manga_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, mangaID); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
@@ -2,7 +2,9 @@ package tcp
 
 import (
 	"encoding/json"
+	"io"
 	"net"
+	"time"
 )
 
 type ProgressEmitter struct {
@@ -14,7 +16,24 @@ func NewProgressEmitter(addr string) (*ProgressEmitter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ProgressEmitter{conn: conn}, nil
+	e := &ProgressEmitter{conn: conn}
+	go e.keepAlive()
+	return e, nil
+}
+
+// keepAlive pings so the server does not reap the emitter, and drains the
+// broadcasts the server sends back so its writes never block on us.
+func (e *ProgressEmitter) keepAlive() {
+	go io.Copy(io.Discard, e.conn)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := e.conn.Write([]byte(`{"type":"PING"}` + "\n")); err != nil {
+			return
+		}
+	}
 }
 
 func (e *ProgressEmitter) Emit(update ProgressUpdate) error {
@@ -22,3 +41,26 @@ func (e *ProgressEmitter) Emit(update ProgressUpdate) error {
 	_, err := e.conn.Write(append(data, '\n'))
 	return err
 }
+
+func (e *ProgressEmitter) EmitComment(evt CommentEvent) error {
+	evt.Type = "COMMENT"
+	data, _ := json.Marshal(evt)
+	_, err := e.conn.Write(append(data, '\n'))
+	return err
+}
+
+// Authenticate identifies the emitter to the server, which it needs
+// before RevokeSession is accepted.
+func (e *ProgressEmitter) Authenticate(token string) error {
+	data, _ := json.Marshal(AuthRequest{Type: "AUTH", Token: token})
+	_, err := e.conn.Write(append(data, '\n'))
+	return err
+}
+
+// RevokeSession tells the server to drop the live connections of a
+// session, or of every session of the user when sessionID is empty.
+func (e *ProgressEmitter) RevokeSession(userID, sessionID string) error {
+	data, _ := json.Marshal(RevokeSession{Type: "REVOKE_SESSION", UserID: userID, SessionID: sessionID})
+	_, err := e.conn.Write(append(data, '\n'))
+	return err
+}
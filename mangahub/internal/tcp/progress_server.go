@@ -7,11 +7,20 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	"mangahub/internal/auth"
+	"mangahub/internal/ratelimit"
 )
 
 type ClientConn struct {
 	conn     net.Conn
 	lastPing time.Time
+	subs     map[string]bool // comment threads, guarded by the server mutex
+
+	// set by AUTH, guarded by the server mutex
+	userID    string
+	sessionID string
+	service   bool
 }
 
 type ProgressSyncServer struct {
@@ -22,6 +31,9 @@ type ProgressSyncServer struct {
 	Buffer    []ProgressUpdate
 	MaxBuffer int
 
+	// Limits caps the messages each client may send; nil for none
+	Limits *ratelimit.Guard
+
 	mu sync.Mutex
 }
 
@@ -65,6 +77,7 @@ func (s *ProgressSyncServer) handleClient(conn net.Conn) {
 	client := &ClientConn{
 		conn:     conn,
 		lastPing: time.Now(),
+		subs:     make(map[string]bool),
 	}
 
 	s.mu.Lock()
@@ -88,6 +101,9 @@ func (s *ProgressSyncServer) handleClient(conn net.Conn) {
 		if err := json.Unmarshal(raw, &base); err != nil {
 			continue
 		}
+		if !s.allow(client, base.Type) {
+			continue
+		}
 
 		switch base.Type {
 		case "PING":
@@ -101,6 +117,51 @@ func (s *ProgressSyncServer) handleClient(conn net.Conn) {
 			}
 			update.Timestamp = time.Now().Unix()
 			s.Broadcast <- update
+
+		case "SUBSCRIBE", "UNSUBSCRIBE":
+			var sub Subscription
+			if err := json.Unmarshal(raw, &sub); err != nil || sub.MangaID == "" {
+				continue
+			}
+			s.mu.Lock()
+			if base.Type == "SUBSCRIBE" {
+				client.subs[sub.key()] = true
+			} else {
+				delete(client.subs, sub.key())
+			}
+			s.mu.Unlock()
+
+		case "AUTH":
+			var req AuthRequest
+			json.Unmarshal(raw, &req)
+			claims, err := auth.ParseAccessToken(req.Token)
+			if err != nil {
+				conn.Write([]byte(`{"type":"AUTH_FAILED"}` + "\n"))
+				continue
+			}
+			s.mu.Lock()
+			client.userID = claims.UserID
+			client.sessionID = claims.SessionID
+			client.service = claims.Role == auth.RoleService
+			s.mu.Unlock()
+			conn.Write([]byte(`{"type":"AUTH_OK"}` + "\n"))
+
+		case "REVOKE_SESSION":
+			var req RevokeSession
+			if err := json.Unmarshal(raw, &req); err != nil || req.UserID == "" {
+				continue
+			}
+			s.revokeSession(client, req)
+
+		case "COMMENT":
+			var evt CommentEvent
+			if err := json.Unmarshal(raw, &evt); err != nil {
+				continue
+			}
+			if evt.Timestamp == 0 {
+				evt.Timestamp = time.Now().Unix()
+			}
+			s.publishComment(client, evt)
 		}
 	}
 
@@ -113,6 +174,35 @@ func (s *ProgressSyncServer) handleClient(conn net.Conn) {
 	fmt.Println("Client disconnected:", addr)
 }
 
+// allow applies the rate limits to a message from client, and tells it
+// when it is refused. Pings keep the connection alive and are free, as
+// is everything from our own services.
+func (s *ProgressSyncServer) allow(client *ClientConn, msgType string) bool {
+	if s.Limits == nil || msgType == "PING" {
+		return true
+	}
+
+	s.mu.Lock()
+	userID, service := client.userID, client.service
+	s.mu.Unlock()
+	if service {
+		return true
+	}
+
+	subject := ratelimit.User(userID)
+	if userID == "" {
+		host, _, _ := net.SplitHostPort(client.conn.RemoteAddr().String())
+		subject = ratelimit.IP(host)
+	}
+
+	r := s.Limits.Allow(subject, "TCP "+msgType)
+	if !r.Allowed {
+		data, _ := json.Marshal(RateLimited{Type: "RATE_LIMITED", RetryAfter: r.RetrySeconds()})
+		client.conn.Write(append(data, '\n'))
+	}
+	return r.Allowed
+}
+
 func (s *ProgressSyncServer) broadcastLoop() {
 	for update := range s.Broadcast {
 		data, _ := json.Marshal(update)
@@ -129,6 +219,51 @@ func (s *ProgressSyncServer) broadcastLoop() {
 		s.mu.Unlock()
 	}
 }
+
+// publishComment pushes evt to clients following its chapter or the
+// whole manga. Comments are not buffered for late joiners. Only service
+// connections may publish: the API server stores and checks a comment
+// before emitting it, so clients cannot post as someone else.
+func (s *ProgressSyncServer) publishComment(from *ClientConn, evt CommentEvent) {
+	data, _ := json.Marshal(evt)
+
+	chapter := Subscription{MangaID: evt.MangaID, Chapter: evt.Chapter}.key()
+	manga := Subscription{MangaID: evt.MangaID}.key()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !from.service {
+		return
+	}
+	for _, client := range s.Clients {
+		if client.subs[chapter] || client.subs[manga] {
+			fmt.Fprintln(client.conn, string(data))
+		}
+	}
+}
+
+// revokeSession closes the connections of a revoked session. The
+// request must come from a service connection, so clients cannot kick
+// each other off.
+func (s *ProgressSyncServer) revokeSession(from *ClientConn, req RevokeSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !from.service {
+		return
+	}
+	for addr, c := range s.Clients {
+		if c.userID != req.UserID || (req.SessionID != "" && c.sessionID != req.SessionID) {
+			continue
+		}
+		fmt.Fprintln(c.conn, `{"type":"SESSION_REVOKED"}`)
+		c.conn.Close()
+		delete(s.Clients, addr)
+		fmt.Println("Session revoked, dropped client:", addr)
+	}
+}
+
 func (s *ProgressSyncServer) reapDeadClients() {
 	ticker := time.NewTicker(10 * time.Second)
 	for range ticker.C {
@@ -1,8 +1,59 @@
 package tcp
 
+import "fmt"
+
 type ProgressUpdate struct {
 	UserID    string `json:"user_id"`
 	MangaID   string `json:"manga_id"`
 	Chapter   int    `json:"chapter"`
 	Timestamp int64  `json:"timestamp"`
 }
+
+// CommentEvent is pushed to clients subscribed to a chapter thread.
+type CommentEvent struct {
+	Type      string `json:"type"` // always "COMMENT"
+	CommentID int64  `json:"comment_id"`
+	ParentID  int64  `json:"parent_id,omitempty"`
+	MangaID   string `json:"manga_id"`
+	Chapter   int    `json:"chapter"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Body      string `json:"body"`
+	Spoiler   bool   `json:"spoiler"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Subscription selects a chapter thread. Chapter 0 means every chapter
+// of the manga.
+type Subscription struct {
+	Type    string `json:"type"` // "SUBSCRIBE" or "UNSUBSCRIBE"
+	MangaID string `json:"manga_id"`
+	Chapter int    `json:"chapter"`
+}
+
+func (s Subscription) key() string {
+	return fmt.Sprintf("%s#%d", s.MangaID, s.Chapter)
+}
+
+// AuthRequest ties a connection to a user session. Clients send their
+// access token; the API server sends a service token.
+type AuthRequest struct {
+	Type  string `json:"type"` // always "AUTH"
+	Token string `json:"token"`
+}
+
+// RevokeSession asks the server to drop every connection of a session.
+// An empty SessionID means every session of the user. Only accepted
+// from service connections.
+type RevokeSession struct {
+	Type      string `json:"type"` // always "REVOKE_SESSION"
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// RateLimited is sent instead of acting on a message over the rate
+// limit. RetryAfter is in seconds.
+type RateLimited struct {
+	Type       string `json:"type"` // always "RATE_LIMITED"
+	RetryAfter int    `json:"retry_after"`
+}
@@ -0,0 +1,87 @@
+package trending
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Kinds of activity that feed the rankings.
+const (
+	KindView       = "view"
+	KindProgress   = "progress"
+	KindLibraryAdd = "library_add"
+	KindRating     = "rating"
+)
+
+// weights says how much one event of each kind is worth. A view is
+// cheap, someone adding a title to their library is not.
+var weights = map[string]float64{
+	KindView:       1,
+	KindProgress:   3,
+	KindRating:     4,
+	KindLibraryAdd: 5,
+}
+
+// Record appends one activity event. userID may be empty for
+// anonymous page views.
+func Record(db *sql.DB, mangaID, userID, kind string) error {
+	var user sql.NullString
+	if userID != "" {
+		user = sql.NullString{String: userID, Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO manga_activity (manga_id, user_id, kind) VALUES (?, ?, ?)
+	`, mangaID, user, kind)
+	return err
+}
+
+// viewWindow is how long repeat views of a title by the same viewer
+// count as one, so reloading a page, or a script doing it, cannot push
+// a title up the rankings.
+const viewWindow = time.Hour
+
+// views remembers when each viewer last counted for each title.
+var views = struct {
+	sync.Mutex
+	seen  map[string]time.Time
+	sweep int // size at which expired entries are dropped
+}{seen: make(map[string]time.Time), sweep: 10000}
+
+// RecordView records a page view of mangaID at most once per viewer
+// and viewWindow. Viewers are told apart by user id when the request
+// has one and by IP otherwise.
+func RecordView(db *sql.DB, mangaID, userID, ip string) error {
+	viewer := "ip:" + ip
+	if userID != "" {
+		viewer = "user:" + userID
+	}
+	key := viewer + "|" + mangaID
+	now := time.Now()
+
+	views.Lock()
+	if last, ok := views.seen[key]; ok && now.Sub(last) < viewWindow {
+		views.Unlock()
+		return nil
+	}
+	views.seen[key] = now
+	if len(views.seen) >= views.sweep {
+		for k, t := range views.seen {
+			if now.Sub(t) >= viewWindow {
+				delete(views.seen, k)
+			}
+		}
+		views.sweep = max(2*len(views.seen), 10000)
+	}
+	views.Unlock()
+
+	return Record(db, mangaID, userID, KindView)
+}
+
+// prune drops events too old to move any ranking.
+func prune(db *sql.DB) error {
+	_, err := db.Exec(`
+		DELETE FROM manga_activity WHERE created_at < datetime('now', '-180 days')
+	`)
+	return err
+}
@@ -0,0 +1,257 @@
+package trending
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEntries is how much of each ranking is kept in the cache.
+const maxEntries = 100
+
+// popularHalfLife is how fast activity fades in the all-time ranking;
+// standing readers and votes do not fade at all.
+const popularHalfLife = 30 * 24 * time.Hour
+
+// Windows are the trending periods the API accepts.
+var Windows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// Entry is one ranked manga.
+type Entry struct {
+	Rank    int     `json:"rank"`
+	MangaID string  `json:"manga_id"`
+	Title   string  `json:"title"`
+	Author  string  `json:"author"`
+	Status  string  `json:"status"`
+	Score   float64 `json:"score"`
+}
+
+// Rankings keeps trending and popular lists in memory and recomputes
+// them on a schedule, so reads never touch the activity table.
+type Rankings struct {
+	db *sql.DB
+
+	mu        sync.RWMutex
+	trending  map[string][]Entry
+	popular   []Entry
+	updatedAt time.Time
+}
+
+func NewRankings(db *sql.DB) *Rankings {
+	return &Rankings{db: db, trending: make(map[string][]Entry)}
+}
+
+// Start refreshes the rankings now and then every interval.
+func (r *Rankings) Start(interval time.Duration) {
+	go func() {
+		for {
+			if err := r.Refresh(); err != nil {
+				log.Println("trending: refresh failed:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Refresh recomputes every ranking and swaps them in at once.
+func (r *Rankings) Refresh() error {
+	if err := prune(r.db); err != nil {
+		return err
+	}
+
+	trending := make(map[string][]Entry, len(Windows))
+	for name, window := range Windows {
+		// a quarter of the window: yesterday still counts in the
+		// weekly list, but for much less than today
+		scores, err := r.activityScores(window, window/4)
+		if err != nil {
+			return err
+		}
+		list, err := r.rank(scores)
+		if err != nil {
+			return err
+		}
+		trending[name] = list
+	}
+
+	scores, err := r.activityScores(0, popularHalfLife)
+	if err != nil {
+		return err
+	}
+	if err := r.addStanding(scores); err != nil {
+		return err
+	}
+	popular, err := r.rank(scores)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.trending = trending
+	r.popular = popular
+	r.updatedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Trending returns the cached ranking of a window and when it was
+// computed.
+func (r *Rankings) Trending(window string) ([]Entry, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.trending[window], r.updatedAt
+}
+
+// Popular returns the cached all-time ranking and when it was computed.
+func (r *Rankings) Popular() ([]Entry, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.popular, r.updatedAt
+}
+
+// activityScores sums weighted events per manga, each halved for every
+// halfLife of age. A zero window means every event still on record.
+func (r *Rankings) activityScores(window, halfLife time.Duration) (map[string]float64, error) {
+	query := `
+		SELECT manga_id, kind, (julianday('now') - julianday(created_at)) * 86400
+		FROM manga_activity
+	`
+	var args []any
+	if window > 0 {
+		query += `WHERE created_at >= datetime('now', ?)`
+		args = append(args, "-"+strconv.Itoa(int(window.Seconds()))+" seconds")
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var mangaID, kind string
+		var age float64
+		if err := rows.Scan(&mangaID, &kind, &age); err != nil {
+			return nil, err
+		}
+		if age < 0 {
+			age = 0
+		}
+		scores[mangaID] += weights[kind] * math.Pow(0.5, age/halfLife.Seconds())
+	}
+	return scores, rows.Err()
+}
+
+// addStanding adds what a title has built up over time: everyone who
+// still has it in their library and everyone who rated it.
+func (r *Rankings) addStanding(scores map[string]float64) error {
+	rows, err := r.db.Query(`
+		SELECT manga_id, COUNT(*) FROM user_progress
+		WHERE COALESCE(status, 'reading') != 'dropped'
+		GROUP BY manga_id
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		scores[id] += weights[KindLibraryAdd] * float64(n)
+	}
+	rows.Close()
+
+	rows, err = r.db.Query(`SELECT manga_id, vote_count FROM manga_scores`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return err
+		}
+		scores[id] += weights[KindRating] * float64(n)
+	}
+	return rows.Err()
+}
+
+// rank sorts scores, keeps the top maxEntries that still exist in the
+// catalog and fills in their titles.
+func (r *Rankings) rank(scores map[string]float64) ([]Entry, error) {
+	ids := make([]string, 0, len(scores))
+	for id, s := range scores {
+		if s > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	// ask for a few extra in case some were deleted from the catalog
+	if len(ids) > maxEntries*2 {
+		ids = ids[:maxEntries*2]
+	}
+
+	list := []Entry{}
+	if len(ids) == 0 {
+		return list, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := r.db.Query(`
+		SELECT id, COALESCE(title, ''), COALESCE(author, ''), COALESCE(status, '')
+		FROM manga
+		WHERE deleted_at IS NULL AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]Entry, len(ids))
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.MangaID, &e.Title, &e.Author, &e.Status); err != nil {
+			return nil, err
+		}
+		found[e.MangaID] = e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		e, ok := found[id]
+		if !ok {
+			continue
+		}
+		e.Rank = len(list) + 1
+		e.Score = math.Round(scores[id]*100) / 100
+		list = append(list, e)
+		if len(list) == maxEntries {
+			break
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,68 @@
+package trending
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes = public rankings, served from the in-memory cache
+func RegisterRoutes(r gin.IRouter, rankings *Rankings) {
+
+	// ---------------------------
+	// GET /manga/trending?window=24h|7d|30d&limit=
+	// ---------------------------
+	r.GET("/manga/trending", func(c *gin.Context) {
+		window := c.DefaultQuery("window", "7d")
+		if _, ok := Windows[window]; !ok {
+			c.JSON(400, gin.H{"error": "Invalid window, use 24h, 7d or 30d"})
+			return
+		}
+
+		list, updated := rankings.Trending(window)
+		c.JSON(200, gin.H{
+			"window":     window,
+			"updated_at": updatedAt(updated),
+			"manga":      top(list, limitParam(c)),
+		})
+	})
+
+	// ---------------------------
+	// GET /manga/popular?limit=
+	// ---------------------------
+	r.GET("/manga/popular", func(c *gin.Context) {
+		list, updated := rankings.Popular()
+		c.JSON(200, gin.H{
+			"updated_at": updatedAt(updated),
+			"manga":      top(list, limitParam(c)),
+		})
+	})
+}
+
+func limitParam(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > maxEntries {
+		limit = 20
+	}
+	return limit
+}
+
+func top(list []Entry, limit int) []Entry {
+	if list == nil {
+		return []Entry{}
+	}
+	if len(list) > limit {
+		return list[:limit]
+	}
+	return list
+}
+
+// updatedAt is null until the first refresh has finished.
+func updatedAt(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
@@ -7,6 +7,9 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
+
+	"mangahub/internal/auth"
+	"mangahub/internal/ratelimit"
 )
 
 type Notification struct {
@@ -22,12 +25,25 @@ type NotificationServer struct {
 	Clients []net.UDPAddr
 	conn    *net.UDPConn // keep the listening connection for broadcasting
 	mu      sync.Mutex
+
+	// sessions maps client addresses that registered with a token to
+	// the session they belong to, so DropSession can find them.
+	sessions map[string]clientSession
+
+	// Limits caps the messages each client may send; nil for none
+	Limits *ratelimit.Guard
+}
+
+type clientSession struct {
+	userID    string
+	sessionID string
 }
 
 func NewNotificationServer(port string) *NotificationServer {
 	return &NotificationServer{
-		Port:    port,
-		Clients: make([]net.UDPAddr, 0),
+		Port:     port,
+		Clients:  make([]net.UDPAddr, 0),
+		sessions: make(map[string]clientSession),
 	}
 }
 
@@ -57,21 +73,35 @@ func (s *NotificationServer) Start() error {
 		}
 
 		var msg struct {
-			Type string `json:"type"`
-			ID   string `json:"id"`
+			Type  string `json:"type"`
+			ID    string `json:"id"`
+			Token string `json:"token"` // optional on REGISTER
 		}
 
 		if err := json.Unmarshal(buf[:n], &msg); err != nil {
 			continue
 		}
+		if !s.allow(clientAddr, msg.Type) {
+			continue
+		}
 
 		switch msg.Type {
 		case "REGISTER":
+			if msg.Token != "" {
+				claims, err := auth.ParseAccessToken(msg.Token)
+				if err != nil {
+					conn.WriteToUDP([]byte(`{"type":"REGISTER_FAILED"}`), clientAddr)
+					continue
+				}
+				s.mu.Lock()
+				s.sessions[clientAddr.String()] = clientSession{claims.UserID, claims.SessionID}
+				s.mu.Unlock()
+			}
 			s.addClient(*clientAddr)
 			conn.WriteToUDP([]byte(`{"type":"REGISTER_ACK"}`), clientAddr)
 
 		case "ACK":
-			fmt.Println("✅ ACK received from", clientAddr)
+			// delivery receipt, nothing to do
 		case "NOTIFY":
 
 		default:
@@ -80,6 +110,29 @@ func (s *NotificationServer) Start() error {
 	}
 }
 
+// allow applies the rate limits to a message from addr, counted per
+// user once the address registered with a token, else per IP.
+func (s *NotificationServer) allow(addr *net.UDPAddr, msgType string) bool {
+	if s.Limits == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	cs, ok := s.sessions[addr.String()]
+	s.mu.Unlock()
+
+	subject := ratelimit.IP(addr.IP.String())
+	if ok {
+		subject = ratelimit.User(cs.userID)
+	}
+
+	r := s.Limits.Allow(subject, "UDP "+msgType)
+	if !r.Allowed {
+		s.conn.WriteToUDP([]byte(fmt.Sprintf(`{"type":"RATE_LIMITED","retry_after":%d}`, r.RetrySeconds())), addr)
+	}
+	return r.Allowed
+}
+
 // thread-safe add client
 func (s *NotificationServer) addClient(addr net.UDPAddr) {
 
@@ -91,18 +144,11 @@ func (s *NotificationServer) addClient(addr net.UDPAddr) {
 			return
 		}
 	}
-	fmt.Println("📥 Total UDP clients:", len(s.Clients))
-
 	s.Clients = append(s.Clients, addr)
-	fmt.Println("📥 Total UDP clients:", len(s.Clients))
-
 }
 
 // Broadcast sends notifications to all clients safely.
 func (s *NotificationServer) Broadcast(note Notification) {
-	fmt.Println("📢 Broadcast called")
-	fmt.Println("📢 Clients count:", len(s.Clients))
-	fmt.Println("📢 Payload:", note)
 	note.ID = uuid.NewString()
 
 	data, err := json.Marshal(note)
@@ -126,12 +172,30 @@ func (s *NotificationServer) Broadcast(note Notification) {
 	// Send to all clients using the same listening connection
 	// This ensures the source port is :9091 which the CLI expects
 	for _, client := range clients {
-		fmt.Println("📤 Sending to client:", client.String())
-		_, err := conn.WriteToUDP(data, &client)
-		if err != nil {
+		if _, err := conn.WriteToUDP(data, &client); err != nil {
 			fmt.Println("UDP write error to", client.String(), ":", err)
-		} else {
-			fmt.Println("✅ Sent to", client.String())
 		}
 	}
 }
+
+// DropSession tells the clients of a revoked session and stops sending
+// them notifications. An empty sessionID drops every session of the user.
+func (s *NotificationServer) DropSession(userID, sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.Clients[:0]
+	for _, c := range s.Clients {
+		cs, ok := s.sessions[c.String()]
+		if !ok || cs.userID != userID || (sessionID != "" && cs.sessionID != sessionID) {
+			kept = append(kept, c)
+			continue
+		}
+		if s.conn != nil {
+			s.conn.WriteToUDP([]byte(`{"type":"SESSION_REVOKED"}`), &c)
+		}
+		delete(s.sessions, c.String())
+		fmt.Println("Session revoked, dropped UDP client:", c.String())
+	}
+	s.Clients = kept
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+
+	"mangahub/internal/auth"
+)
+
+// Account is a user as admins see it.
+type Account struct {
+	ID          string           `json:"id"`
+	Username    string           `json:"username"`
+	DisplayName string           `json:"display_name"`
+	Role        string           `json:"role"`
+	Suspension  *auth.Suspension `json:"suspension"`
+	Sessions    int              `json:"sessions"`
+	LibrarySize int              `json:"library_size"`
+}
+
+// AccountFilter narrows ListAccounts. Empty fields match everything.
+type AccountFilter struct {
+	Query     string // part of the username or display name
+	Role      string
+	Suspended bool
+}
+
+const selectAccount = `
+	SELECT CAST(u.id AS TEXT), u.username, COALESCE(u.display_name, ''), COALESCE(u.role, 'user'),
+	       u.suspended_at, u.suspended_until, u.suspension_reason, u.suspended_by,
+	       (SELECT COUNT(*) FROM sessions s WHERE s.user_id = CAST(u.id AS TEXT)),
+	       (SELECT COUNT(*) FROM user_progress p WHERE p.user_id = CAST(u.id AS TEXT))
+	FROM users u
+`
+
+func scanAccount(row interface{ Scan(...any) error }) (*Account, error) {
+	var a Account
+	var since, until sql.NullTime
+	var reason, by sql.NullString
+	err := row.Scan(&a.ID, &a.Username, &a.DisplayName, &a.Role,
+		&since, &until, &reason, &by, &a.Sessions, &a.LibrarySize)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.Suspension = auth.SuspensionFromColumns(since, until, reason, by)
+	return &a, nil
+}
+
+// GetAccount loads one account by id.
+func GetAccount(db *sql.DB, id string) (*Account, error) {
+	return scanAccount(db.QueryRow(selectAccount+`WHERE u.id = ?`, id))
+}
+
+// ListAccounts pages through users matching f, newest first, along
+// with the total number of matches.
+func ListAccounts(db *sql.DB, f AccountFilter, limit, offset int) ([]*Account, int, error) {
+	where := `WHERE 1 = 1`
+	var args []any
+	if f.Query != "" {
+		where += ` AND (u.username LIKE ? OR u.display_name LIKE ?)`
+		like := "%" + f.Query + "%"
+		args = append(args, like, like)
+	}
+	if f.Role != "" {
+		where += ` AND COALESCE(u.role, 'user') = ?`
+		args = append(args, f.Role)
+	}
+	if f.Suspended {
+		where += ` AND u.suspended_at IS NOT NULL AND (u.suspended_until IS NULL OR u.suspended_until > ?)`
+		args = append(args, time.Now().UTC())
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users u `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(selectAccount+where+` ORDER BY u.id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []*Account{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, a)
+	}
+	return list, total, rows.Err()
+}
+
+// SetRole changes a user's role. The new role shows up in their next
+// access token.
+func SetRole(db *sql.DB, id, role string) error {
+	_, err := db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	return err
+}
+
+// countAdmins is used to refuse demoting the last admin.
+func countAdmins(db *sql.DB) int {
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, auth.RoleAdmin).Scan(&n)
+	return n
+}
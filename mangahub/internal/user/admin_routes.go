@@ -0,0 +1,299 @@
+package user
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
+)
+
+func RegisterAdminRoutes(r *gin.RouterGroup, db *sql.DB) {
+	mod := r.Group("", auth.RequirePermission(auth.PermUserBan))
+	adm := r.Group("", auth.AdminOnly())
+
+	// GET /admin/users?q=&role=&suspended=1&limit=&offset=
+	mod.GET("/users", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if limit <= 0 || limit > 200 {
+			limit = 50
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		f := AccountFilter{
+			Query:     strings.TrimSpace(c.Query("q")),
+			Role:      c.Query("role"),
+			Suspended: c.Query("suspended") == "1",
+		}
+		list, total, err := ListAccounts(db, f, limit, offset)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"users": list, "total": total})
+	})
+
+	// GET /admin/users/:id
+	mod.GET("/users/:id", func(c *gin.Context) {
+		a, ok := loadAccount(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(200, a)
+	})
+
+	// PUT /admin/users/:id/role  {"role": "moderator"}
+	adm.PUT("/users/:id/role", func(c *gin.Context) {
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+		if !auth.ValidRole(db, req.Role) {
+			c.JSON(400, gin.H{"error": "unknown role"})
+			return
+		}
+
+		a, ok := loadAccount(c, db)
+		if !ok {
+			return
+		}
+		if a.Role == auth.RoleAdmin && req.Role != auth.RoleAdmin && countAdmins(db) <= 1 {
+			c.JSON(409, gin.H{"error": "cannot demote the last admin"})
+			return
+		}
+
+		if err := SetRole(db, a.ID, req.Role); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "user.role_change", "user", a.ID)
+		e.Before = map[string]string{"role": a.Role}
+		e.After = map[string]string{"role": req.Role}
+		audit.Record(db, e)
+		c.JSON(200, gin.H{"message": "role updated", "role": req.Role})
+	})
+
+	// POST /admin/users/:id/suspend  {"reason": "...", "until": RFC3339 | "days": n}
+	// neither until nor days means until lifted by hand
+	mod.POST("/users/:id/suspend", func(c *gin.Context) {
+		var req struct {
+			Reason string `json:"reason"`
+			Until  string `json:"until"`
+			Days   int    `json:"days"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			c.JSON(400, gin.H{"error": "missing reason"})
+			return
+		}
+
+		var until *time.Time
+		switch {
+		case req.Until != "":
+			t, err := time.Parse(time.RFC3339, req.Until)
+			if err != nil || !t.After(time.Now()) {
+				c.JSON(400, gin.H{"error": "until must be a future RFC3339 time"})
+				return
+			}
+			until = &t
+		case req.Days > 0:
+			t := time.Now().Add(time.Duration(req.Days) * 24 * time.Hour)
+			until = &t
+		case req.Days < 0:
+			c.JSON(400, gin.H{"error": "days must be positive"})
+			return
+		}
+
+		a, ok := loadAccount(c, db)
+		if !ok {
+			return
+		}
+		if a.ID == c.GetString("user_id") {
+			c.JSON(409, gin.H{"error": "cannot suspend yourself"})
+			return
+		}
+		if !canModerate(c, a) {
+			return
+		}
+
+		if err := auth.Suspend(db, a.ID, req.Reason, until, c.GetString("user_id")); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "user.suspend", "user", a.ID)
+		e.Before = a.Suspension
+		a, _ = GetAccount(db, a.ID)
+		e.After = a.Suspension
+		audit.Record(db, e)
+		c.JSON(200, a)
+	})
+
+	// DELETE /admin/users/:id/suspend
+	mod.DELETE("/users/:id/suspend", func(c *gin.Context) {
+		a, ok := loadAccount(c, db)
+		if !ok {
+			return
+		}
+		if !canModerate(c, a) {
+			return
+		}
+		if err := auth.Unsuspend(db, a.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "user.unsuspend", "user", a.ID)
+		e.Before = a.Suspension
+		audit.Record(db, e)
+		c.JSON(200, gin.H{"message": "suspension lifted"})
+	})
+
+	// DELETE /admin/users/:id/sessions (force logout everywhere)
+	mod.DELETE("/users/:id/sessions", func(c *gin.Context) {
+		a, ok := loadAccount(c, db)
+		if !ok || !canModerate(c, a) {
+			return
+		}
+		if err := auth.RevokeAllSessions(db, a.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "session.revoke_all", "user", a.ID)
+		e.After = map[string]int{"revoked": a.Sessions}
+		audit.Record(db, e)
+		c.JSON(200, gin.H{"message": "sessions revoked", "revoked": a.Sessions})
+	})
+
+	// GET /admin/security/2fa
+	adm.GET("/security/2fa", func(c *gin.Context) {
+		roles, err := auth.TOTPRequiredRoles(db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"required_roles": roles})
+	})
+
+	// PUT /admin/security/2fa  {"role": "admin", "required": true}
+	// applies from each user's next login
+	adm.PUT("/security/2fa", func(c *gin.Context) {
+		var req struct {
+			Role     string `json:"role"`
+			Required bool   `json:"required"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+		if !auth.ValidRole(db, req.Role) {
+			c.JSON(400, gin.H{"error": "unknown role"})
+			return
+		}
+
+		before := auth.TOTPRequired(db, req.Role)
+		if err := auth.SetTOTPRequired(db, req.Role, req.Required); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "security.2fa_policy", "role", req.Role)
+		e.Before = map[string]bool{"required": before}
+		e.After = map[string]bool{"required": req.Required}
+		audit.Record(db, e)
+		c.JSON(200, gin.H{"role": req.Role, "required": req.Required})
+	})
+
+	// GET /admin/roles
+	adm.GET("/roles", func(c *gin.Context) {
+		roles, err := auth.ListRoles(db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"roles": roles, "permissions": auth.AllPermissions})
+	})
+
+	// PUT /admin/roles/:name  {"permissions": ["manga:write", ...]}
+	// creates the role if needed; applies from each user's next token
+	adm.PUT("/roles/:name", func(c *gin.Context) {
+		var req struct {
+			Permissions []string `json:"permissions"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid json"})
+			return
+		}
+
+		before := auth.RolePermissions(db, c.Param("name"))
+		err := auth.SaveRole(db, c.Param("name"), req.Permissions)
+		switch err {
+		case nil:
+			e := audit.FromRequest(c, "role.save", "role", c.Param("name"))
+			if before != nil {
+				e.Before = map[string][]string{"permissions": before}
+			}
+			e.After = map[string][]string{"permissions": req.Permissions}
+			audit.Record(db, e)
+			c.JSON(200, gin.H{"name": c.Param("name"), "permissions": req.Permissions})
+		case auth.ErrFixedRole:
+			c.JSON(409, gin.H{"error": err.Error()})
+		case auth.ErrRoleName, auth.ErrUnknownPerm:
+			c.JSON(400, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	})
+
+	// DELETE /admin/roles/:name
+	adm.DELETE("/roles/:name", func(c *gin.Context) {
+		before := auth.RolePermissions(db, c.Param("name"))
+		err := auth.DeleteRole(db, c.Param("name"))
+		switch err {
+		case nil:
+			e := audit.FromRequest(c, "role.delete", "role", c.Param("name"))
+			e.Before = map[string][]string{"permissions": before}
+			audit.Record(db, e)
+			c.JSON(200, gin.H{"message": "role deleted"})
+		case auth.ErrRoleMissing:
+			c.JSON(404, gin.H{"error": err.Error()})
+		case auth.ErrFixedRole, auth.ErrDefaultRole, auth.ErrRoleInUse:
+			c.JSON(409, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	})
+}
+
+// canModerate keeps staff accounts out of reach of moderators; only
+// admins may suspend or log out another staff member.
+func canModerate(c *gin.Context, a *Account) bool {
+	if a.Role != auth.RoleUser && c.GetString("role") != auth.RoleAdmin {
+		c.JSON(403, gin.H{"error": "only admins can act on staff accounts"})
+		return false
+	}
+	return true
+}
+
+func loadAccount(c *gin.Context, db *sql.DB) (*Account, bool) {
+	a, err := GetAccount(db, c.Param("id"))
+	if err == ErrUserNotFound {
+		c.JSON(404, gin.H{"error": "user not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return a, true
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
+)
+
+func RegisterAPIKeyRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/me/api-keys
+	// ---------------------------
+	r.GET("/users/me/api-keys", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		list, err := auth.ListAPIKeys(db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, list)
+	})
+
+	// ---------------------------
+	// POST /users/me/api-keys {"name", "scopes", "expires_in_days"}
+	// the key is only shown in this response
+	// ---------------------------
+	r.POST("/users/me/api-keys", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req auth.APIKeyRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		if msg := req.Validate(); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		k, key, err := auth.CreateAPIKey(db, userID, c.GetString("role"), req)
+		switch err {
+		case nil:
+			e := audit.FromRequest(c, "api_key.create", "api_key", k.ID)
+			e.After = k
+			audit.Record(db, e)
+			c.JSON(201, gin.H{
+				"api_key": k,
+				"key":     key,
+				"message": "Store this key now, it will not be shown again",
+			})
+		case auth.ErrScopeForbidden:
+			c.JSON(403, gin.H{"error": "Only staff accounts can create keys with the admin scope"})
+		case auth.ErrTooManyAPIKeys:
+			c.JSON(409, gin.H{"error": "Too many API keys, delete one first"})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	})
+
+	// ---------------------------
+	// DELETE /users/me/api-keys/:id
+	// ---------------------------
+	r.DELETE("/users/me/api-keys/:id", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		err := auth.DeleteAPIKey(db, userID, c.Param("id"))
+		switch err {
+		case nil:
+			audit.Record(db, audit.FromRequest(c, "api_key.revoke", "api_key", c.Param("id")))
+			c.JSON(200, gin.H{"message": "API key deleted"})
+		case auth.ErrAPIKeyNotFound:
+			c.JSON(404, gin.H{"error": "API key not found"})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/auth"
+	"mangahub/internal/mailer"
+)
+
+func RegisterEmailRoutes(r gin.IRouter, db *sql.DB, m mailer.Mailer) {
+
+	// ---------------------------
+	// PUT /users/me/email {"email": "..."} (sends a verification link)
+	// ---------------------------
+	r.PUT("/users/me/email", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		err := auth.SetEmail(db, m, userID, req.Email)
+		switch err {
+		case nil:
+			c.JSON(200, gin.H{"message": "Check your inbox to verify the new address"})
+		case auth.ErrInvalidEmail:
+			c.JSON(400, gin.H{"error": "Invalid email address"})
+		case auth.ErrEmailTaken:
+			c.JSON(409, gin.H{"error": "Email already in use"})
+		default:
+			log.Println("set email:", err)
+			c.JSON(500, gin.H{"error": "Could not send verification email"})
+		}
+	})
+
+	// ---------------------------
+	// POST /users/me/email/verification (send the link again)
+	// ---------------------------
+	r.POST("/users/me/email/verification", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		err := auth.SendVerificationEmail(db, m, userID)
+		switch err {
+		case nil:
+			c.JSON(200, gin.H{"message": "Verification email sent"})
+		case auth.ErrNoEmail:
+			c.JSON(400, gin.H{"error": "Add an email address first"})
+		case auth.ErrEmailVerified:
+			c.JSON(409, gin.H{"error": "Email already verified"})
+		default:
+			log.Println("verification email:", err)
+			c.JSON(500, gin.H{"error": "Could not send verification email"})
+		}
+	})
+}
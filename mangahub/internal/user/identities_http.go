@@ -0,0 +1,86 @@
+package user
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
+)
+
+// RegisterIdentityRoutes = external login providers linked to the
+// account
+func RegisterIdentityRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/me/identities
+	// ---------------------------
+	r.GET("/users/me/identities", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		list, err := auth.ListIdentities(db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"identities": list, "providers": auth.OIDCProviders()})
+	})
+
+	// ---------------------------
+	// POST /users/me/identities/:provider
+	// returns the URL to open; the provider's callback finishes the link
+	// ---------------------------
+	r.POST("/users/me/identities/:provider", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		authURL, browser, err := auth.BeginOIDC(db, c.Param("provider"), userID, "")
+		switch {
+		case err == auth.ErrUnknownProvider:
+			c.JSON(404, gin.H{"error": "Unknown provider"})
+		case err != nil:
+			log.Println("oidc:", err)
+			c.JSON(502, gin.H{"error": "Provider unavailable"})
+		default:
+			// the callback only finishes the link in this browser
+			auth.SetOIDCCookie(c, browser)
+			c.JSON(200, gin.H{"authorization_url": authURL})
+		}
+	})
+
+	// ---------------------------
+	// DELETE /users/me/identities/:provider
+	// ---------------------------
+	r.DELETE("/users/me/identities/:provider", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		err := auth.UnlinkIdentity(db, userID, c.Param("provider"))
+		switch err {
+		case nil:
+			e := audit.FromRequest(c, "identity.unlink", "user", userID)
+			e.Before = map[string]string{"provider": c.Param("provider")}
+			audit.Record(db, e)
+			c.JSON(200, gin.H{"message": "Provider unlinked"})
+		case auth.ErrIdentityNotFound:
+			c.JSON(404, gin.H{"error": "Provider not linked"})
+		case auth.ErrLastLogin:
+			c.JSON(409, gin.H{"error": "This is your only way to log in, set a password first (forgot password)"})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	})
+}
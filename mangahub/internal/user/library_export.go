@@ -0,0 +1,227 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Supported export formats. FormatMAL is shared with imports.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// LibraryEntry is one row of a user's library joined with its manga.
+type LibraryEntry struct {
+	MangaID        string `json:"manga_id"`
+	Title          string `json:"title"`
+	Status         string `json:"status"`
+	CurrentChapter int    `json:"current_chapter"`
+	TotalChapters  int    `json:"total_chapters"`
+	MalID          int    `json:"mal_id,omitempty"` // 0 if no import told us
+	UpdatedAt      string `json:"updated_at,omitempty"`
+}
+
+// LoadLibrary returns every progress row of userID, ordered by title.
+func LoadLibrary(db *sql.DB, userID string) ([]LibraryEntry, error) {
+	rows, err := db.Query(`
+		SELECT p.manga_id, COALESCE(m.title, ''), COALESCE(p.status, 'reading'),
+		       p.current_chapter, COALESCE(m.total_chapters, 0), COALESCE(p.mal_id, 0),
+		       COALESCE(p.updated_at, '')
+		FROM user_progress p
+		LEFT JOIN manga m ON m.id = p.manga_id
+		WHERE p.user_id = ? AND m.deleted_at IS NULL
+		ORDER BY m.title COLLATE NOCASE
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []LibraryEntry{}
+	for rows.Next() {
+		var e LibraryEntry
+		if err := rows.Scan(&e.MangaID, &e.Title, &e.Status, &e.CurrentChapter, &e.TotalChapters, &e.MalID, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// ExportContentType returns the MIME type and file extension for format.
+func ExportContentType(format string) (string, string, bool) {
+	switch format {
+	case FormatMAL:
+		return "application/xml", "xml", true
+	case FormatCSV:
+		return "text/csv", "csv", true
+	case FormatJSON:
+		return "application/json", "json", true
+	}
+	return "", "", false
+}
+
+// WriteExport encodes entries in format to w.
+func WriteExport(w io.Writer, format, userID string, entries []LibraryEntry) error {
+	switch format {
+	case FormatMAL:
+		return writeMAL(w, entries)
+	case FormatCSV:
+		return writeCSV(w, entries)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			UserID     string         `json:"user_id"`
+			ExportedAt time.Time      `json:"exported_at"`
+			Entries    []LibraryEntry `json:"entries"`
+		}{userID, time.Now().UTC(), entries})
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+func writeCSV(w io.Writer, entries []LibraryEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"manga_id", "title", "status", "current_chapter", "total_chapters", "mal_id", "updated_at"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.MangaID,
+			e.Title,
+			e.Status,
+			strconv.Itoa(e.CurrentChapter),
+			strconv.Itoa(e.TotalChapters),
+			strconv.Itoa(e.MalID),
+			e.UpdatedAt,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ---------------------------
+// MyAnimeList XML
+// ---------------------------
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+type malExportInfo struct {
+	ExportType int `xml:"user_export_type"`
+	Total      int `xml:"user_total_manga"`
+	Reading    int `xml:"user_total_reading"`
+	Completed  int `xml:"user_total_completed"`
+	OnHold     int `xml:"user_total_onhold"`
+	Dropped    int `xml:"user_total_dropped"`
+	PlanToRead int `xml:"user_total_plantoread"`
+}
+
+type malExportManga struct {
+	ID             int    `xml:"manga_mangadb_id"`
+	Title          cdata  `xml:"manga_title"`
+	Volumes        int    `xml:"manga_volumes"`
+	Chapters       int    `xml:"manga_chapters"`
+	MyID           int    `xml:"my_id"`
+	ReadVolumes    int    `xml:"my_read_volumes"`
+	ReadChapters   int    `xml:"my_read_chapters"`
+	StartDate      string `xml:"my_start_date"`
+	FinishDate     string `xml:"my_finish_date"`
+	Score          int    `xml:"my_score"`
+	Status         string `xml:"my_status"`
+	Comments       cdata  `xml:"my_comments"`
+	TimesRead      int    `xml:"my_times_read"`
+	Tags           cdata  `xml:"my_tags"`
+	UpdateOnImport int    `xml:"update_on_import"`
+}
+
+// MissingMalIDs returns the entries a MAL export cannot name: MAL
+// imports by manga_mangadb_id, and we only know it for manga that came
+// in through a MAL or AniList import.
+func MissingMalIDs(entries []LibraryEntry) []LibraryEntry {
+	missing := []LibraryEntry{}
+	for _, e := range entries {
+		if e.MalID == 0 {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
+
+// writeMAL writes the <myanimelist> layout MAL and most trackers import.
+// Entries without a MAL id are left out; see MissingMalIDs.
+func writeMAL(w io.Writer, entries []LibraryEntry) error {
+	doc := struct {
+		XMLName xml.Name         `xml:"myanimelist"`
+		Info    malExportInfo    `xml:"myinfo"`
+		Manga   []malExportManga `xml:"manga"`
+	}{
+		Info: malExportInfo{ExportType: 2, Total: len(entries)},
+	}
+
+	for _, e := range entries {
+		if e.MalID == 0 {
+			doc.Info.Total--
+			continue
+		}
+		switch e.Status {
+		case StatusCompleted:
+			doc.Info.Completed++
+		case StatusOnHold:
+			doc.Info.OnHold++
+		case StatusDropped:
+			doc.Info.Dropped++
+		case StatusPlanToRead:
+			doc.Info.PlanToRead++
+		default:
+			doc.Info.Reading++
+		}
+
+		finish := "0000-00-00"
+		if e.Status == StatusCompleted && len(e.UpdatedAt) >= 10 {
+			finish = e.UpdatedAt[:10]
+		}
+
+		doc.Manga = append(doc.Manga, malExportManga{
+			ID:             e.MalID,
+			Title:          cdata{e.Title},
+			Chapters:       e.TotalChapters,
+			ReadChapters:   e.CurrentChapter,
+			StartDate:      "0000-00-00",
+			FinishDate:     finish,
+			Status:         malStatusLabel(e.Status),
+			UpdateOnImport: 1,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func malStatusLabel(s string) string {
+	switch s {
+	case StatusCompleted:
+		return "Completed"
+	case StatusOnHold:
+		return "On-Hold"
+	case StatusDropped:
+		return "Dropped"
+	case StatusPlanToRead:
+		return "Plan to Read"
+	}
+	return "Reading"
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps uploaded export files.
+const maxImportSize = 10 << 20
+
+func RegisterLibraryRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// POST /users/library/import?format=mal|anilist
+	// body: the export file, raw or as multipart field "file"
+	// ---------------------------
+	r.POST("/users/library/import", func(c *gin.Context) {
+
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+		data, err := readUpload(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Could not read upload"})
+			return
+		}
+
+		format, entries, err := ParseExport(c.Query("format"), data)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := ImportLibrary(db, userID, format, entries)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, report)
+	})
+
+	// ---------------------------
+	// GET /users/library/export?format=mal|csv|json[&skip_unknown=true]
+	// ---------------------------
+	r.GET("/users/library/export", func(c *gin.Context) {
+
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		format := c.DefaultQuery("format", FormatJSON)
+		contentType, ext, ok := ExportContentType(format)
+		if !ok {
+			c.JSON(400, gin.H{"error": "format must be mal, csv or json"})
+			return
+		}
+
+		entries, err := LoadLibrary(db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// MAL matches on its own ids, which we only have for manga
+		// imported from MAL or AniList; say which ones would be lost
+		if format == FormatMAL {
+			missing := MissingMalIDs(entries)
+			if len(missing) > 0 && c.Query("skip_unknown") != "true" {
+				c.JSON(422, gin.H{
+					"error":   fmt.Sprintf("%d entries have no MyAnimeList id; pass skip_unknown=true to export the rest", len(missing)),
+					"missing": missing,
+				})
+				return
+			}
+			c.Header("X-Export-Skipped", strconv.Itoa(len(missing)))
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="mangahub-library.`+ext+`"`)
+		c.Status(200)
+
+		if err := WriteExport(c.Writer, format, userID, entries); err != nil {
+			c.Error(err)
+		}
+	})
+}
+
+func readUpload(c *gin.Context) ([]byte, error) {
+	if c.ContentType() == "multipart/form-data" {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(c.Request.Body)
+}
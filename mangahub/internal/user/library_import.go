@@ -0,0 +1,411 @@
+package user
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Supported import formats.
+const (
+	FormatMAL     = "mal"
+	FormatAniList = "anilist"
+)
+
+// minTitleSimilarity is the lowest trigram similarity accepted when an
+// entry has to be matched by title.
+const minTitleSimilarity = 0.75
+
+// ImportEntry is one list entry read from an external tracker export.
+type ImportEntry struct {
+	SourceID string `json:"source_id"`
+	Title    string `json:"title"`
+	Chapter  int    `json:"chapter"`
+	Status   string `json:"status"`
+	MalID    int    `json:"mal_id,omitempty"` // MyAnimeList id, when the export has it
+}
+
+// UnmatchedEntry is an entry that could not be linked to a manga row.
+type UnmatchedEntry struct {
+	SourceID string `json:"source_id,omitempty"`
+	Title    string `json:"title"`
+	Reason   string `json:"reason"`
+}
+
+// ImportReport summarises a finished import.
+type ImportReport struct {
+	Total     int              `json:"total"`
+	Imported  int              `json:"imported"`
+	ByID      int              `json:"matched_by_id"`
+	ByTitle   int              `json:"matched_by_title"`
+	Unmatched []UnmatchedEntry `json:"unmatched"`
+}
+
+// ---------------------------
+// MyAnimeList XML
+// ---------------------------
+
+type malExport struct {
+	Manga []struct {
+		ID     string `xml:"manga_mangadb_id"`
+		Title  string `xml:"manga_title"`
+		Read   int    `xml:"my_read_chapters"`
+		Status string `xml:"my_status"`
+	} `xml:"manga"`
+}
+
+// ParseMAL reads a MyAnimeList manga list export (<myanimelist> XML).
+func ParseMAL(r io.Reader) ([]ImportEntry, error) {
+	var doc malExport
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid MAL export: %w", err)
+	}
+
+	entries := make([]ImportEntry, 0, len(doc.Manga))
+	for _, m := range doc.Manga {
+		id := strings.TrimSpace(m.ID)
+		malID, _ := strconv.Atoi(id)
+		entries = append(entries, ImportEntry{
+			SourceID: id,
+			MalID:    malID,
+			Title:    strings.TrimSpace(m.Title),
+			Chapter:  m.Read,
+			Status:   malStatus(m.Status),
+		})
+	}
+	return entries, nil
+}
+
+// MAL exports use either the label or its numeric code.
+func malStatus(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "reading", "1":
+		return StatusReading
+	case "completed", "2":
+		return StatusCompleted
+	case "on-hold", "on hold", "3":
+		return StatusOnHold
+	case "dropped", "4":
+		return StatusDropped
+	case "plan to read", "6":
+		return StatusPlanToRead
+	}
+	return StatusReading
+}
+
+// ---------------------------
+// AniList JSON
+// ---------------------------
+
+type anilistList struct {
+	Name    string `json:"name"`
+	Entries []struct {
+		MediaID  int    `json:"mediaId"`
+		Status   string `json:"status"`
+		Progress int    `json:"progress"`
+		Media    struct {
+			ID    int `json:"id"`
+			IDMal int `json:"idMal"`
+			Title struct {
+				Romaji  string `json:"romaji"`
+				English string `json:"english"`
+			} `json:"title"`
+		} `json:"media"`
+	} `json:"entries"`
+}
+
+// Both the raw GraphQL MediaListCollection response and its unwrapped
+// {"lists": [...]} form are accepted.
+type anilistExport struct {
+	Lists []anilistList `json:"lists"`
+	Data  struct {
+		MediaListCollection struct {
+			Lists []anilistList `json:"lists"`
+		} `json:"MediaListCollection"`
+	} `json:"data"`
+}
+
+// ParseAniList reads an AniList manga list export.
+func ParseAniList(r io.Reader) ([]ImportEntry, error) {
+	var doc anilistExport
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid AniList export: %w", err)
+	}
+
+	lists := doc.Lists
+	if len(lists) == 0 {
+		lists = doc.Data.MediaListCollection.Lists
+	}
+
+	var entries []ImportEntry
+	for _, l := range lists {
+		for _, e := range l.Entries {
+			id := e.MediaID
+			if id == 0 {
+				id = e.Media.ID
+			}
+			title := e.Media.Title.Romaji
+			if title == "" {
+				title = e.Media.Title.English
+			}
+
+			entry := ImportEntry{
+				Title:   title,
+				Chapter: e.Progress,
+				Status:  anilistStatus(e.Status),
+				MalID:   e.Media.IDMal,
+			}
+			if id != 0 {
+				entry.SourceID = strconv.Itoa(id)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func anilistStatus(s string) string {
+	switch strings.ToUpper(s) {
+	case "CURRENT", "REPEATING":
+		return StatusReading
+	case "COMPLETED":
+		return StatusCompleted
+	case "PAUSED":
+		return StatusOnHold
+	case "DROPPED":
+		return StatusDropped
+	case "PLANNING":
+		return StatusPlanToRead
+	}
+	return StatusReading
+}
+
+// ParseExport picks the parser for format and returns the format used.
+// An empty format is detected from the first non-blank byte.
+func ParseExport(format string, data []byte) (string, []ImportEntry, error) {
+	if format == "" {
+		trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace)
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("<")):
+			format = FormatMAL
+		case bytes.HasPrefix(trimmed, []byte("{")):
+			format = FormatAniList
+		}
+	}
+
+	var entries []ImportEntry
+	var err error
+	switch format {
+	case FormatMAL:
+		entries, err = ParseMAL(bytes.NewReader(data))
+	case FormatAniList:
+		entries, err = ParseAniList(bytes.NewReader(data))
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	return format, entries, err
+}
+
+// ---------------------------
+// Matching
+// ---------------------------
+
+type catalogTitle struct {
+	id       string
+	trigrams map[string]struct{}
+}
+
+// catalogMatcher links import entries to manga rows. AniList ids are
+// our manga ids (see aniAPI), everything else is matched by title.
+type catalogMatcher struct {
+	ids    map[string]bool
+	exact  map[string]string
+	titles []catalogTitle
+}
+
+func loadCatalogMatcher(db *sql.DB) (*catalogMatcher, error) {
+	rows, err := db.Query(`SELECT id, title FROM manga WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := &catalogMatcher{
+		ids:   make(map[string]bool),
+		exact: make(map[string]string),
+	}
+	for rows.Next() {
+		var id string
+		var title sql.NullString
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, err
+		}
+		m.ids[id] = true
+
+		norm := normalizeTitle(title.String)
+		if norm == "" {
+			continue
+		}
+		if _, dup := m.exact[norm]; !dup {
+			m.exact[norm] = id
+		}
+		m.titles = append(m.titles, catalogTitle{id: id, trigrams: trigrams(norm)})
+	}
+	return m, rows.Err()
+}
+
+// match returns the manga id for e and whether it was found by id.
+func (m *catalogMatcher) match(format string, e ImportEntry) (string, bool) {
+	if format == FormatAniList && m.ids[e.SourceID] {
+		return e.SourceID, true
+	}
+
+	norm := normalizeTitle(e.Title)
+	if norm == "" {
+		return "", false
+	}
+	if id, ok := m.exact[norm]; ok {
+		return id, false
+	}
+
+	want := trigrams(norm)
+	best, bestScore := "", 0.0
+	for _, t := range m.titles {
+		if score := similarity(want, t.trigrams); score > bestScore {
+			best, bestScore = t.id, score
+		}
+	}
+	if bestScore < minTitleSimilarity {
+		return "", false
+	}
+	return best, false
+}
+
+func normalizeTitle(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space && b.Len() > 0 {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func trigrams(s string) map[string]struct{} {
+	padded := []rune("  " + s + " ")
+	set := make(map[string]struct{}, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = struct{}{}
+	}
+	return set
+}
+
+// similarity is the Dice coefficient of two trigram sets.
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if _, ok := b[t]; ok {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// ---------------------------
+// Import
+// ---------------------------
+
+// ImportLibrary matches entries against the catalog and upserts the
+// user's progress rows. Existing progress is never moved backwards.
+// MAL ids are kept with the rows so MAL exports can name the manga.
+func ImportLibrary(db *sql.DB, userID, format string, entries []ImportEntry) (*ImportReport, error) {
+	matcher, err := loadCatalogMatcher(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO user_progress(user_id, manga_id, current_chapter, status, mal_id, updated_at)
+		VALUES(?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, manga_id)
+		DO UPDATE SET
+			current_chapter = MAX(user_progress.current_chapter, excluded.current_chapter),
+			status = excluded.status,
+			mal_id = COALESCE(excluded.mal_id, user_progress.mal_id),
+			updated_at = excluded.updated_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	report := &ImportReport{Total: len(entries), Unmatched: []UnmatchedEntry{}}
+	seen := make(map[string]bool)
+
+	for _, e := range entries {
+		mangaID, byID := matcher.match(format, e)
+		if mangaID == "" {
+			report.Unmatched = append(report.Unmatched, UnmatchedEntry{
+				SourceID: e.SourceID,
+				Title:    e.Title,
+				Reason:   "no matching manga",
+			})
+			continue
+		}
+		if seen[mangaID] {
+			report.Unmatched = append(report.Unmatched, UnmatchedEntry{
+				SourceID: e.SourceID,
+				Title:    e.Title,
+				Reason:   "duplicate of manga " + mangaID,
+			})
+			continue
+		}
+		seen[mangaID] = true
+
+		chapter := e.Chapter
+		if chapter < 0 {
+			chapter = 0
+		}
+		status := e.Status
+		if !validStatus(status) {
+			status = StatusReading
+		}
+
+		malID := sql.NullInt64{Int64: int64(e.MalID), Valid: e.MalID > 0}
+		if _, err := stmt.Exec(userID, mangaID, chapter, status, malID); err != nil {
+			return nil, err
+		}
+
+		report.Imported++
+		if byID {
+			report.ByID++
+		} else {
+			report.ByTitle++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,296 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mangahub/internal/auth"
+)
+
+// Spoiler modes: hide spoilers completely, blur them until clicked, or
+// show them as plain text.
+const (
+	SpoilerHide = "hide"
+	SpoilerBlur = "blur"
+	SpoilerShow = "show"
+)
+
+const (
+	maxDisplayName = 50
+	maxBio         = 500
+	maxAvatarURL   = 500
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	languageCode    = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+)
+
+// Preferences are per-user settings. Missing rows read as the defaults.
+type Preferences struct {
+	Language              string `json:"language"`
+	SpoilerMode           string `json:"spoiler_mode"`
+	NotifyNewChapters     bool   `json:"notify_new_chapters"`
+	NotifyReplies         bool   `json:"notify_replies"`
+	NotifyRecommendations bool   `json:"notify_recommendations"`
+	ProfilePublic         bool   `json:"profile_public"`
+	ShowLibrary           bool   `json:"show_library"`
+	ShowRatings           bool   `json:"show_ratings"`
+}
+
+// Profile is what a user sees about themselves on /users/me.
+type Profile struct {
+	ID            string      `json:"id"`
+	Username      string      `json:"username"`
+	Role          string      `json:"role"`
+	Email         string      `json:"email"`
+	EmailVerified bool        `json:"email_verified"`
+	DisplayName   string      `json:"display_name"`
+	AvatarURL     string      `json:"avatar_url"`
+	Bio           string      `json:"bio"`
+	Preferences   Preferences `json:"preferences"`
+
+	// only filled in on /users/me
+	APIKeys    []auth.APIKey   `json:"api_keys,omitempty"`
+	Identities []auth.Identity `json:"identities,omitempty"`
+}
+
+// ProfileUpdate is a partial update; nil fields are left alone.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Bio         *string `json:"bio"`
+	Preferences *struct {
+		Language              *string `json:"language"`
+		SpoilerMode           *string `json:"spoiler_mode"`
+		NotifyNewChapters     *bool   `json:"notify_new_chapters"`
+		NotifyReplies         *bool   `json:"notify_replies"`
+		NotifyRecommendations *bool   `json:"notify_recommendations"`
+		ProfilePublic         *bool   `json:"profile_public"`
+		ShowLibrary           *bool   `json:"show_library"`
+		ShowRatings           *bool   `json:"show_ratings"`
+	} `json:"preferences"`
+}
+
+const selectProfile = `
+	SELECT CAST(u.id AS TEXT), u.username, COALESCE(u.role, 'user'),
+	       COALESCE(u.email, ''), u.email_verified_at IS NOT NULL,
+	       COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), COALESCE(u.bio, ''),
+	       COALESCE(p.language, 'en'), COALESCE(p.spoiler_mode, 'hide'),
+	       COALESCE(p.notify_new_chapters, 1), COALESCE(p.notify_replies, 1),
+	       COALESCE(p.notify_recommendations, 0), COALESCE(p.profile_public, 1),
+	       COALESCE(p.show_library, 1), COALESCE(p.show_ratings, 1)
+	FROM users u
+	LEFT JOIN user_preferences p ON p.user_id = CAST(u.id AS TEXT)
+`
+
+func scanProfile(row *sql.Row) (*Profile, error) {
+	var p Profile
+	pr := &p.Preferences
+	err := row.Scan(&p.ID, &p.Username, &p.Role, &p.Email, &p.EmailVerified, &p.DisplayName, &p.AvatarURL, &p.Bio,
+		&pr.Language, &pr.SpoilerMode, &pr.NotifyNewChapters, &pr.NotifyReplies,
+		&pr.NotifyRecommendations, &pr.ProfilePublic, &pr.ShowLibrary, &pr.ShowRatings)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetProfile loads a profile by user id.
+func GetProfile(db *sql.DB, userID string) (*Profile, error) {
+	return scanProfile(db.QueryRow(selectProfile+`WHERE u.id = ?`, userID))
+}
+
+// GetProfileByUsername loads a profile by username.
+func GetProfileByUsername(db *sql.DB, username string) (*Profile, error) {
+	return scanProfile(db.QueryRow(selectProfile+`WHERE u.username = ?`, username))
+}
+
+// Validate trims the update in place and returns a message for the
+// first invalid field, or "".
+func (u *ProfileUpdate) Validate() string {
+	if u.DisplayName != nil {
+		*u.DisplayName = strings.TrimSpace(*u.DisplayName)
+		if len(*u.DisplayName) > maxDisplayName {
+			return "display_name too long"
+		}
+	}
+	if u.Bio != nil {
+		*u.Bio = strings.TrimSpace(*u.Bio)
+		if len(*u.Bio) > maxBio {
+			return "bio too long"
+		}
+	}
+	if u.AvatarURL != nil {
+		*u.AvatarURL = strings.TrimSpace(*u.AvatarURL)
+		if *u.AvatarURL != "" {
+			parsed, err := url.Parse(*u.AvatarURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+				len(*u.AvatarURL) > maxAvatarURL {
+				return "avatar_url must be an http(s) URL"
+			}
+		}
+	}
+	if p := u.Preferences; p != nil {
+		if p.Language != nil && !languageCode.MatchString(*p.Language) {
+			return "language must be a code like en or pt-BR"
+		}
+		if p.SpoilerMode != nil {
+			switch *p.SpoilerMode {
+			case SpoilerHide, SpoilerBlur, SpoilerShow:
+			default:
+				return "spoiler_mode must be hide, blur or show"
+			}
+		}
+	}
+	return ""
+}
+
+// UpdateProfile applies a validated update on top of the current
+// profile.
+func UpdateProfile(db *sql.DB, userID string, u *ProfileUpdate) (*Profile, error) {
+	cur, err := GetProfile(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setBool := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	set(&cur.DisplayName, u.DisplayName)
+	set(&cur.AvatarURL, u.AvatarURL)
+	set(&cur.Bio, u.Bio)
+	pr := &cur.Preferences
+	if p := u.Preferences; p != nil {
+		set(&pr.Language, p.Language)
+		set(&pr.SpoilerMode, p.SpoilerMode)
+		setBool(&pr.NotifyNewChapters, p.NotifyNewChapters)
+		setBool(&pr.NotifyReplies, p.NotifyReplies)
+		setBool(&pr.NotifyRecommendations, p.NotifyRecommendations)
+		setBool(&pr.ProfilePublic, p.ProfilePublic)
+		setBool(&pr.ShowLibrary, p.ShowLibrary)
+		setBool(&pr.ShowRatings, p.ShowRatings)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users SET display_name = ?, avatar_url = ?, bio = ? WHERE id = ?
+	`, cur.DisplayName, cur.AvatarURL, cur.Bio, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_preferences (user_id, language, spoiler_mode, notify_new_chapters,
+			notify_replies, notify_recommendations, profile_public, show_library, show_ratings)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			language = excluded.language,
+			spoiler_mode = excluded.spoiler_mode,
+			notify_new_chapters = excluded.notify_new_chapters,
+			notify_replies = excluded.notify_replies,
+			notify_recommendations = excluded.notify_recommendations,
+			profile_public = excluded.profile_public,
+			show_library = excluded.show_library,
+			show_ratings = excluded.show_ratings
+	`, userID, pr.Language, pr.SpoilerMode, pr.NotifyNewChapters, pr.NotifyReplies,
+		pr.NotifyRecommendations, pr.ProfilePublic, pr.ShowLibrary, pr.ShowRatings); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// PublicProfile is what anyone can see about a user, limited by their
+// privacy settings.
+type PublicProfile struct {
+	Username    string         `json:"username"`
+	DisplayName string         `json:"display_name"`
+	AvatarURL   string         `json:"avatar_url,omitempty"`
+	Bio         string         `json:"bio,omitempty"`
+	Private     bool           `json:"private"`
+	Library     map[string]int `json:"library,omitempty"`
+	Ratings     *RatingSummary `json:"ratings,omitempty"`
+}
+
+// RatingSummary counts what a user has rated and reviewed.
+type RatingSummary struct {
+	Rated    int     `json:"rated"`
+	Average  float64 `json:"average"`
+	Reviewed int     `json:"reviewed"`
+}
+
+// GetPublicProfile builds the public view of username. A private
+// profile only shows who the user is.
+func GetPublicProfile(db *sql.DB, username string) (*PublicProfile, error) {
+	p, err := GetProfileByUsername(db, username)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &PublicProfile{
+		Username:    p.Username,
+		DisplayName: p.DisplayName,
+		Private:     !p.Preferences.ProfilePublic,
+	}
+	if pub.Private {
+		return pub, nil
+	}
+	pub.AvatarURL = p.AvatarURL
+	pub.Bio = p.Bio
+
+	if p.Preferences.ShowLibrary {
+		rows, err := db.Query(`
+			SELECT COALESCE(status, 'reading'), COUNT(*)
+			FROM user_progress WHERE user_id = ?
+			GROUP BY COALESCE(status, 'reading')
+		`, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		pub.Library = make(map[string]int)
+		for rows.Next() {
+			var status string
+			var n int
+			if err := rows.Scan(&status, &n); err != nil {
+				return nil, err
+			}
+			pub.Library[status] = n
+		}
+	}
+
+	if p.Preferences.ShowRatings {
+		var r RatingSummary
+		db.QueryRow(`
+			SELECT COUNT(*), COALESCE(ROUND(AVG(score), 2), 0) FROM ratings WHERE user_id = ?
+		`, p.ID).Scan(&r.Rated, &r.Average)
+		db.QueryRow(`
+			SELECT COUNT(*) FROM reviews WHERE user_id = ? AND hidden = 0
+		`, p.ID).Scan(&r.Reviewed)
+		pub.Ratings = &r
+	}
+	return pub, nil
+}
@@ -0,0 +1,141 @@
+package user
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
+)
+
+func RegisterProfileRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/me
+	// ---------------------------
+	r.GET("/users/me", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		p, err := GetProfile(db, userID)
+		if err == ErrUserNotFound {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if p.APIKeys, err = auth.ListAPIKeys(db, userID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if p.Identities, err = auth.ListIdentities(db, userID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, p)
+	})
+
+	// ---------------------------
+	// PATCH /users/me (only the fields sent are changed)
+	// ---------------------------
+	r.PATCH("/users/me", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req ProfileUpdate
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		if msg := req.Validate(); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		p, err := UpdateProfile(db, userID, &req)
+		if err == ErrUserNotFound {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, p)
+	})
+
+	// ---------------------------
+	// PUT /users/me/password
+	// logs out every device; the caller gets a fresh session
+	// ---------------------------
+	r.PUT("/users/me/password", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req struct {
+			OldPassword string `json:"old_password"`
+			NewPassword string `json:"new_password"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		err := auth.ChangePassword(db, userID, req.OldPassword, req.NewPassword)
+		switch {
+		case err == auth.ErrWrongPassword:
+			c.JSON(403, gin.H{"error": "Old password is incorrect"})
+			return
+		case err == auth.ErrWeakPassword:
+			c.JSON(400, gin.H{"error": "New password must be at least 6 characters"})
+			return
+		case err == sql.ErrNoRows:
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		case err != nil:
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Record(db, audit.FromRequest(c, "auth.password_change", "user", userID))
+
+		// every session is gone, including this one: start a new one
+		sessionID, refresh, _ := auth.CreateSession(db, userID, auth.DeviceFromRequest(c, ""))
+		access, _ := auth.AccessTokenFor(db, userID, sessionID)
+		c.JSON(200, gin.H{
+			"message":       "Password changed, other sessions were logged out",
+			"access_token":  access,
+			"refresh_token": refresh,
+		})
+	})
+}
+
+// RegisterPublicProfileRoutes = profiles anyone can look at
+func RegisterPublicProfileRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/:username
+	// ---------------------------
+	r.GET("/users/:username", func(c *gin.Context) {
+		p, err := GetPublicProfile(db, c.Param("username"))
+		if err == ErrUserNotFound {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, p)
+	})
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"database/sql"
 	"mangahub/internal/tcp"
+	"mangahub/internal/trending"
 	"net/http"
 	"time"
 
@@ -22,6 +23,7 @@ func RegisterProgressRoutes(r gin.IRouter, db *sql.DB, emitter *tcp.ProgressEmit
 		var req struct {
 			MangaID string `json:"manga_id"`
 			Chapter int    `json:"chapter"`
+			Status  string `json:"status"`
 		}
 
 		if err := c.BindJSON(&req); err != nil {
@@ -34,18 +36,43 @@ func RegisterProgressRoutes(r gin.IRouter, db *sql.DB, emitter *tcp.ProgressEmit
 			return
 		}
 
+		if req.Status != "" && !validStatus(req.Status) {
+			c.JSON(400, gin.H{"error": "Invalid status"})
+			return
+		}
+
+		// an empty status keeps whatever the row already has
+		var status sql.NullString
+		if req.Status != "" {
+			status = sql.NullString{String: req.Status, Valid: true}
+		}
+
+		var existing int
+		db.QueryRow(`
+			SELECT COUNT(*) FROM user_progress WHERE user_id = ? AND manga_id = ?
+		`, userID, req.MangaID).Scan(&existing)
+
 		_, err := db.Exec(`
-			INSERT INTO user_progress(user_id, manga_id, current_chapter)
-			VALUES(?, ?, ?)
+			INSERT INTO user_progress(user_id, manga_id, current_chapter, status, updated_at)
+			VALUES(?, ?, ?, COALESCE(?, 'reading'), CURRENT_TIMESTAMP)
 			ON CONFLICT(user_id, manga_id)
-			DO UPDATE SET current_chapter = excluded.current_chapter
-		`, userID, req.MangaID, req.Chapter)
+			DO UPDATE SET
+				current_chapter = excluded.current_chapter,
+				status = COALESCE(?, user_progress.status, 'reading'),
+				updated_at = excluded.updated_at
+		`, userID, req.MangaID, req.Chapter, status, status)
 
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
+		kind := trending.KindProgress
+		if existing == 0 {
+			kind = trending.KindLibraryAdd
+		}
+		_ = trending.Record(db, req.MangaID, userID, kind)
+
 		// 🔴 REAL-TIME PUSH (safe)
 		if emitter != nil {
 			_ = emitter.Emit(tcp.ProgressUpdate{
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/audit"
+	"mangahub/internal/auth"
+)
+
+func RegisterSessionRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/sessions
+	// ---------------------------
+	r.GET("/users/sessions", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		list, err := auth.ListSessions(db, userID, c.GetString("session_id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, list)
+	})
+
+	// ---------------------------
+	// DELETE /users/sessions (every session except this one)
+	// ---------------------------
+	r.DELETE("/users/sessions", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		n, err := auth.RevokeOtherSessions(db, userID, c.GetString("session_id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		e := audit.FromRequest(c, "session.revoke_others", "user", userID)
+		e.After = map[string]any{"revoked": n, "kept": c.GetString("session_id")}
+		audit.Record(db, e)
+
+		c.JSON(200, gin.H{"message": "Other sessions logged out", "revoked": n})
+	})
+
+	// ---------------------------
+	// DELETE /users/sessions/:id
+	// ---------------------------
+	r.DELETE("/users/sessions/:id", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		err := auth.RevokeSession(db, userID, c.Param("id"))
+		if err == auth.ErrSessionNotFound {
+			c.JSON(404, gin.H{"error": "Session not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.Record(db, audit.FromRequest(c, "session.revoke", "session", c.Param("id")))
+		c.JSON(200, gin.H{"message": "Session logged out"})
+	})
+}
@@ -0,0 +1,18 @@
+package user
+
+// Reading statuses stored in user_progress.status.
+const (
+	StatusReading    = "reading"
+	StatusCompleted  = "completed"
+	StatusOnHold     = "on_hold"
+	StatusDropped    = "dropped"
+	StatusPlanToRead = "plan_to_read"
+)
+
+func validStatus(s string) bool {
+	switch s {
+	case StatusReading, StatusCompleted, StatusOnHold, StatusDropped, StatusPlanToRead:
+		return true
+	}
+	return false
+}
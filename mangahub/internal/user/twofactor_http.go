@@ -0,0 +1,133 @@
+package user
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mangahub/internal/auth"
+)
+
+func RegisterTwoFactorRoutes(r gin.IRouter, db *sql.DB) {
+
+	// ---------------------------
+	// GET /users/me/2fa
+	// ---------------------------
+	r.GET("/users/me/2fa", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		tf, err := auth.GetTwoFactor(db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, tf)
+	})
+
+	// ---------------------------
+	// POST /users/me/2fa/enroll (returns the secret and otpauth URI)
+	// ---------------------------
+	r.POST("/users/me/2fa/enroll", func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		secret, uri, err := auth.BeginTOTPEnrollment(db, userID)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"secret": secret, "otpauth_uri": uri})
+	})
+
+	// ---------------------------
+	// POST /users/me/2fa/verify {"code": "123456"} (finishes enrollment)
+	// ---------------------------
+	r.POST("/users/me/2fa/verify", func(c *gin.Context) {
+		userID, code, ok := twoFactorRequest(c)
+		if !ok {
+			return
+		}
+
+		codes, err := auth.ConfirmTOTPEnrollment(db, userID, code)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+	})
+
+	// ---------------------------
+	// POST /users/me/2fa/recovery-codes {"code": "..."} (new set)
+	// ---------------------------
+	r.POST("/users/me/2fa/recovery-codes", func(c *gin.Context) {
+		userID, code, ok := twoFactorRequest(c)
+		if !ok {
+			return
+		}
+
+		codes, err := auth.RegenerateRecoveryCodes(db, userID, code)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"recovery_codes": codes})
+	})
+
+	// ---------------------------
+	// DELETE /users/me/2fa {"code": "..."}
+	// ---------------------------
+	r.DELETE("/users/me/2fa", func(c *gin.Context) {
+		userID, code, ok := twoFactorRequest(c)
+		if !ok {
+			return
+		}
+
+		if err := auth.DisableTOTP(db, userID, code); err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{"message": "Two-factor authentication disabled"})
+	})
+}
+
+func twoFactorRequest(c *gin.Context) (userID, code string, ok bool) {
+	userID = c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", "", false
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(400, gin.H{"error": "Missing code"})
+		return "", "", false
+	}
+	return userID, req.Code, true
+}
+
+func twoFactorError(c *gin.Context, err error) {
+	switch err {
+	case auth.ErrInvalidCode:
+		c.JSON(400, gin.H{"error": "Invalid code"})
+	case auth.ErrTOTPEnabled:
+		c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+	case auth.ErrTOTPNotEnabled:
+		c.JSON(409, gin.H{"error": "Two-factor authentication is not enabled"})
+	case auth.ErrTOTPNotPending:
+		c.JSON(409, gin.H{"error": "Start enrollment first"})
+	case auth.ErrTOTPRequired:
+		c.JSON(403, gin.H{"error": "Your role requires two-factor authentication"})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
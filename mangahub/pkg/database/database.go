@@ -31,12 +31,28 @@ func InitDB(path string) *sql.DB {
 
 	// Create required tables if missing
 	createTables(db)
+	migrateEmailVerification(db)
+	addColumns(db)
+	migrateRefreshTokens(db)
+
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(email)`); err != nil {
+		log.Fatalf("failed to create email index: %v", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_manga_deleted ON manga(deleted_at)`); err != nil {
+		log.Fatalf("failed to create trash index: %v", err)
+	}
 
 	return db
 }
 
 func createTables(db *sql.DB) {
 	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        username TEXT UNIQUE NOT NULL,
+        password_hash TEXT NOT NULL,
+        role TEXT DEFAULT 'user'
+    );`,
 		`CREATE TABLE IF NOT EXISTS manga (
         id TEXT PRIMARY KEY,
         title TEXT,
@@ -44,7 +60,9 @@ func createTables(db *sql.DB) {
         genres TEXT,
         status TEXT,
         total_chapters INTEGER,
-        description TEXT
+        description TEXT,
+        version INTEGER NOT NULL DEFAULT 1,
+        deleted_at TIMESTAMP
     );`,
 		`CREATE TABLE IF NOT EXISTS user_progress (
         user_id TEXT,
@@ -52,13 +70,263 @@ func createTables(db *sql.DB) {
         current_chapter INTEGER,
         status TEXT,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        mal_id INTEGER,
         PRIMARY KEY (user_id, manga_id)
     );`,
 		`CREATE TABLE IF NOT EXISTS refresh_tokens (
         token TEXT PRIMARY KEY,
         user_id TEXT,
-        expires_at TIMESTAMP
+        family_id TEXT,
+        expires_at TIMESTAMP,
+        created_at TIMESTAMP,
+        used_at TIMESTAMP
+    );`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        device_name TEXT,
+        ip TEXT,
+        user_agent TEXT,
+        created_at TIMESTAMP,
+        last_used_at TIMESTAMP
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+		`CREATE TABLE IF NOT EXISTS collections (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id TEXT NOT NULL,
+        slug TEXT UNIQUE NOT NULL,
+        name TEXT NOT NULL,
+        description TEXT NOT NULL DEFAULT '',
+        visibility TEXT NOT NULL DEFAULT 'private',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_collections_user ON collections(user_id);`,
+		`CREATE TABLE IF NOT EXISTS collection_items (
+        collection_id INTEGER NOT NULL,
+        manga_id TEXT NOT NULL,
+        position INTEGER NOT NULL,
+        note TEXT NOT NULL DEFAULT '',
+        added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (collection_id, manga_id),
+        FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+        FOREIGN KEY (manga_id) REFERENCES manga(id) ON DELETE CASCADE
+    );`,
+		`CREATE TABLE IF NOT EXISTS ratings (
+        user_id TEXT NOT NULL,
+        manga_id TEXT NOT NULL,
+        score INTEGER NOT NULL CHECK (score BETWEEN 1 AND 10),
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, manga_id)
+    );`,
+		// running totals so scores never need a full scan of ratings
+		`CREATE TABLE IF NOT EXISTS manga_scores (
+        manga_id TEXT PRIMARY KEY,
+        vote_count INTEGER NOT NULL DEFAULT 0,
+        score_sum INTEGER NOT NULL DEFAULT 0
+    );`,
+		`CREATE TABLE IF NOT EXISTS rating_totals (
+        id INTEGER PRIMARY KEY CHECK (id = 1),
+        vote_count INTEGER NOT NULL DEFAULT 0,
+        score_sum INTEGER NOT NULL DEFAULT 0
+    );`,
+		`INSERT OR IGNORE INTO rating_totals (id, vote_count, score_sum) VALUES (1, 0, 0);`,
+		`CREATE TABLE IF NOT EXISTS reviews (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id TEXT NOT NULL,
+        manga_id TEXT NOT NULL,
+        body TEXT NOT NULL,
+        spoiler INTEGER NOT NULL DEFAULT 0,
+        helpful_count INTEGER NOT NULL DEFAULT 0,
+        hidden INTEGER NOT NULL DEFAULT 0,
+        hidden_reason TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (user_id, manga_id)
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_reviews_manga ON reviews(manga_id);`,
+		`CREATE TABLE IF NOT EXISTS review_revisions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        review_id INTEGER NOT NULL,
+        body TEXT NOT NULL,
+        spoiler INTEGER NOT NULL,
+        edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE
+    );`,
+		`CREATE TABLE IF NOT EXISTS review_votes (
+        review_id INTEGER NOT NULL,
+        user_id TEXT NOT NULL,
+        PRIMARY KEY (review_id, user_id),
+        FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE
+    );`,
+		`CREATE TABLE IF NOT EXISTS comments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        manga_id TEXT NOT NULL,
+        chapter INTEGER NOT NULL,
+        user_id TEXT NOT NULL,
+        parent_id INTEGER REFERENCES comments(id),
+        body TEXT NOT NULL,
+        spoiler INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        edited_at TIMESTAMP,
+        deleted_at TIMESTAMP,
+        deleted_by TEXT
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_thread ON comments(manga_id, chapter);`,
+		`CREATE TABLE IF NOT EXISTS comment_reports (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        comment_id INTEGER NOT NULL,
+        reporter_id TEXT NOT NULL,
+        reason TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        resolved_at TIMESTAMP,
+        resolved_by TEXT,
+        resolution TEXT,
+        UNIQUE (comment_id, reporter_id),
+        FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+    );`,
+		`CREATE TABLE IF NOT EXISTS manga_similar (
+        manga_id TEXT NOT NULL,
+        similar_id TEXT NOT NULL,
+        score REAL NOT NULL,
+        co_readers INTEGER NOT NULL,
+        computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (manga_id, similar_id)
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_user_progress_manga ON user_progress(manga_id);`,
+		`CREATE TABLE IF NOT EXISTS manga_activity (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        manga_id TEXT NOT NULL,
+        user_id TEXT,
+        kind TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_manga_activity_time ON manga_activity(created_at);`,
+		`CREATE TABLE IF NOT EXISTS user_preferences (
+        user_id TEXT PRIMARY KEY,
+        language TEXT NOT NULL DEFAULT 'en',
+        spoiler_mode TEXT NOT NULL DEFAULT 'hide',
+        notify_new_chapters INTEGER NOT NULL DEFAULT 1,
+        notify_replies INTEGER NOT NULL DEFAULT 1,
+        notify_recommendations INTEGER NOT NULL DEFAULT 0,
+        profile_public INTEGER NOT NULL DEFAULT 1,
+        show_library INTEGER NOT NULL DEFAULT 1,
+        show_ratings INTEGER NOT NULL DEFAULT 1
+    );`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id TEXT NOT NULL,
+        code_hash TEXT NOT NULL,
+        used_at TIMESTAMP
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);`,
+		`CREATE TABLE IF NOT EXISTS login_challenges (
+        token TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        device_name TEXT,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        expires_at TIMESTAMP NOT NULL
+    );`,
+		`CREATE TABLE IF NOT EXISTS login_failures (
+        username TEXT PRIMARY KEY,
+        failures INTEGER NOT NULL DEFAULT 0,
+        last_failed_at TIMESTAMP,
+        locked_until TIMESTAMP
+    );`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        created_at TIMESTAMP NOT NULL,
+        actor_id TEXT,
+        actor_name TEXT,
+        action TEXT NOT NULL,
+        target_type TEXT,
+        target_id TEXT,
+        ip TEXT,
+        before_json TEXT,
+        after_json TEXT
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);`,
+		// the audit log is append-only
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+    BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+    BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+		`CREATE TABLE IF NOT EXISTS email_tokens (
+        token TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        purpose TEXT NOT NULL,
+        email TEXT NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP
+    );`,
+		`CREATE TABLE IF NOT EXISTS role_policies (
+        role TEXT PRIMARY KEY,
+        require_2fa INTEGER NOT NULL DEFAULT 0
+    );`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        prefix TEXT NOT NULL,
+        key_hash TEXT NOT NULL UNIQUE,
+        scopes TEXT NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        expires_at TIMESTAMP,
+        last_used_at TIMESTAMP,
+        last_used_ip TEXT
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`,
+		`CREATE TABLE IF NOT EXISTS roles (
+        name TEXT PRIMARY KEY,
+        permissions TEXT NOT NULL DEFAULT ''
+    );`,
+		`CREATE TABLE IF NOT EXISTS user_identities (
+        provider TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        email TEXT,
+        linked_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (provider, subject),
+        UNIQUE (user_id, provider)
     );`,
+		`CREATE TABLE IF NOT EXISTS oidc_logins (
+        state TEXT PRIMARY KEY,
+        provider TEXT NOT NULL,
+        code_verifier TEXT NOT NULL,
+        nonce TEXT NOT NULL,
+        user_id TEXT,
+        device_name TEXT,
+        browser TEXT,
+        expires_at TIMESTAMP NOT NULL
+    );`,
+		// what purging a manga from the trash removed: the manga, its
+		// revisions and the progress and reviews readers had for it, as JSON
+		`CREATE TABLE IF NOT EXISTS manga_archive (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        manga_id TEXT NOT NULL,
+        title TEXT NOT NULL,
+        data TEXT NOT NULL,
+        deleted_at TIMESTAMP,
+        purged_at TIMESTAMP NOT NULL
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_manga_archive_manga ON manga_archive(manga_id);`,
+
+		// one row per stored change to a manga: the fields it changed,
+		// who changed them and the manga as it was afterwards
+		`CREATE TABLE IF NOT EXISTS manga_revisions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        manga_id TEXT NOT NULL,
+        version INTEGER NOT NULL,
+        action TEXT NOT NULL,
+        editor_id TEXT,
+        editor_name TEXT,
+        changes TEXT NOT NULL,
+        snapshot TEXT NOT NULL,
+        revert_of INTEGER,
+        created_at TIMESTAMP NOT NULL
+    );`,
+		`CREATE INDEX IF NOT EXISTS idx_manga_revisions_manga ON manga_revisions(manga_id, id);`,
 	}
 
 	for _, stmt := range stmts {
@@ -67,3 +335,108 @@ func createTables(db *sql.DB) {
 		}
 	}
 }
+
+// addColumns brings databases created by older builds up to date.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so check table_info first.
+func addColumns(db *sql.DB) {
+	cols := []struct {
+		table, name, decl string
+	}{
+		{"user_progress", "status", "TEXT"},
+		{"user_progress", "updated_at", "TIMESTAMP"},
+		{"user_progress", "mal_id", "INTEGER"}, // from library imports, for MAL exports
+		{"users", "display_name", "TEXT"},
+		{"users", "avatar_url", "TEXT"},
+		{"users", "bio", "TEXT"},
+		{"users", "suspended_at", "TIMESTAMP"},
+		{"users", "suspended_until", "TIMESTAMP"},
+		{"users", "suspension_reason", "TEXT"},
+		{"users", "suspended_by", "TEXT"},
+		{"users", "email", "TEXT"},
+		{"users", "totp_secret", "TEXT"},
+		{"users", "totp_pending_secret", "TEXT"},
+		{"users", "totp_enabled_at", "TIMESTAMP"},
+		{"users", "totp_last_step", "INTEGER"},
+		{"oidc_logins", "browser", "TEXT"}, // hash of the OIDC cookie
+		{"refresh_tokens", "family_id", "TEXT"},
+		{"refresh_tokens", "created_at", "TIMESTAMP"},
+		{"refresh_tokens", "used_at", "TIMESTAMP"},
+		{"manga", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"manga", "deleted_at", "TIMESTAMP"},
+	}
+
+	for _, col := range cols {
+		if hasColumn(db, col.table, col.name) {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.name, col.decl)
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("failed to add column: %v\nSQL: %s", err, stmt)
+		}
+	}
+}
+
+func hasColumn(db *sql.DB, table, column string) bool {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Fatalf("failed to read table info for %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			log.Fatalf("failed to scan table info for %s: %v", table, err)
+		}
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateRefreshTokens removes refresh tokens from before they were
+// hashed and grouped into families. They cannot be verified any more,
+// so their owners simply log in again. The family index needs the
+// columns from addColumns, so it is created here too, and families
+// from before sessions were tracked get a session row.
+func migrateRefreshTokens(db *sql.DB) {
+	stmts := []string{
+		`DELETE FROM refresh_tokens WHERE family_id IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+		`INSERT INTO sessions (id, user_id, device_name, created_at, last_used_at)
+		SELECT family_id, user_id, 'Unknown device', MIN(created_at), MAX(created_at)
+		FROM refresh_tokens
+		WHERE family_id NOT IN (SELECT id FROM sessions)
+		GROUP BY family_id`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("failed to migrate refresh tokens: %v\nSQL: %s", err, stmt)
+		}
+	}
+}
+
+// migrateEmailVerification adds users.email_verified_at. Accounts from
+// before email verification existed count as verified, so they keep
+// everything they could do.
+func migrateEmailVerification(db *sql.DB) {
+	if !hasColumn(db, "users", "email_verified_at") {
+		stmts := []string{
+			`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP`,
+			`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP`,
+		}
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				log.Fatalf("failed to migrate email verification: %v\nSQL: %s", err, stmt)
+			}
+		}
+	}
+}
@@ -1,11 +0,0 @@
-package models
-
-type Manga struct {
-	ID            string   `json:"id"`
-	Title         string   `json:"title"`
-	Author        string   `json:"author"`
-	Genres        []string `json:"genres"`
-	Status        string   `json:"status"`
-	TotalChapters int      `json:"total_chapters"`
-	Description   string   `json:"description"`
-}
@@ -74,6 +74,8 @@ type MangaResponse struct {
 	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
 	TotalChapters int32                  `protobuf:"varint,6,opt,name=total_chapters,json=totalChapters,proto3" json:"total_chapters,omitempty"`
 	Description   string                 `protobuf:"bytes,7,opt,name=description,proto3" json:"description,omitempty"`
+	Score         float64                `protobuf:"fixed64,8,opt,name=score,proto3" json:"score,omitempty"` // Bayesian average, 0 when unrated
+	VoteCount     int32                  `protobuf:"varint,9,opt,name=vote_count,json=voteCount,proto3" json:"vote_count,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -157,6 +159,20 @@ func (x *MangaResponse) GetDescription() string {
 	return ""
 }
 
+func (x *MangaResponse) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *MangaResponse) GetVoteCount() int32 {
+	if x != nil {
+		return x.VoteCount
+	}
+	return 0
+}
+
 type SearchRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
@@ -545,13 +561,445 @@ func (x *GetProgressResponse) GetCurrentChapter() int32 {
 	return 0
 }
 
+type GetCollectionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slug          string                 `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCollectionRequest) Reset() {
+	*x = GetCollectionRequest{}
+	mi := &file_proto_manga_manga_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCollectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCollectionRequest) ProtoMessage() {}
+
+func (x *GetCollectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCollectionRequest.ProtoReflect.Descriptor instead.
+func (*GetCollectionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetCollectionRequest) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+type CollectionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slug          string                 `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Owner         string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	Items         []*SearchResult        `protobuf:"bytes,5,rep,name=items,proto3" json:"items,omitempty"` // in list order
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CollectionResponse) Reset() {
+	*x = CollectionResponse{}
+	mi := &file_proto_manga_manga_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollectionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollectionResponse) ProtoMessage() {}
+
+func (x *CollectionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollectionResponse.ProtoReflect.Descriptor instead.
+func (*CollectionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CollectionResponse) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *CollectionResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CollectionResponse) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *CollectionResponse) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *CollectionResponse) GetItems() []*SearchResult {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ListCollectionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCollectionsRequest) Reset() {
+	*x = ListCollectionsRequest{}
+	mi := &file_proto_manga_manga_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCollectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCollectionsRequest) ProtoMessage() {}
+
+func (x *ListCollectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCollectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListCollectionsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListCollectionsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type CollectionSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slug          string                 `protobuf:"bytes,1,opt,name=slug,proto3" json:"slug,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	ItemCount     int32                  `protobuf:"varint,4,opt,name=item_count,json=itemCount,proto3" json:"item_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CollectionSummary) Reset() {
+	*x = CollectionSummary{}
+	mi := &file_proto_manga_manga_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollectionSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollectionSummary) ProtoMessage() {}
+
+func (x *CollectionSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollectionSummary.ProtoReflect.Descriptor instead.
+func (*CollectionSummary) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CollectionSummary) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *CollectionSummary) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CollectionSummary) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *CollectionSummary) GetItemCount() int32 {
+	if x != nil {
+		return x.ItemCount
+	}
+	return 0
+}
+
+type ListCollectionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Collections   []*CollectionSummary   `protobuf:"bytes,1,rep,name=collections,proto3" json:"collections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCollectionsResponse) Reset() {
+	*x = ListCollectionsResponse{}
+	mi := &file_proto_manga_manga_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCollectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCollectionsResponse) ProtoMessage() {}
+
+func (x *ListCollectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCollectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListCollectionsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListCollectionsResponse) GetCollections() []*CollectionSummary {
+	if x != nil {
+		return x.Collections
+	}
+	return nil
+}
+
+type RecommendRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecommendRequest) Reset() {
+	*x = RecommendRequest{}
+	mi := &file_proto_manga_manga_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecommendRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecommendRequest) ProtoMessage() {}
+
+func (x *RecommendRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecommendRequest.ProtoReflect.Descriptor instead.
+func (*RecommendRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RecommendRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *RecommendRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type Recommendation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Manga         *SearchResult          `protobuf:"bytes,1,opt,name=manga,proto3" json:"manga,omitempty"`
+	Score         float64                `protobuf:"fixed64,2,opt,name=score,proto3" json:"score,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recommendation) Reset() {
+	*x = Recommendation{}
+	mi := &file_proto_manga_manga_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recommendation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recommendation) ProtoMessage() {}
+
+func (x *Recommendation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recommendation.ProtoReflect.Descriptor instead.
+func (*Recommendation) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Recommendation) GetManga() *SearchResult {
+	if x != nil {
+		return x.Manga
+	}
+	return nil
+}
+
+func (x *Recommendation) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Recommendation) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type RecommendResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Recommendations []*Recommendation      `protobuf:"bytes,1,rep,name=recommendations,proto3" json:"recommendations,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *RecommendResponse) Reset() {
+	*x = RecommendResponse{}
+	mi := &file_proto_manga_manga_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecommendResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecommendResponse) ProtoMessage() {}
+
+func (x *RecommendResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manga_manga_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecommendResponse.ProtoReflect.Descriptor instead.
+func (*RecommendResponse) Descriptor() ([]byte, []int) {
+	return file_proto_manga_manga_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RecommendResponse) GetRecommendations() []*Recommendation {
+	if x != nil {
+		return x.Recommendations
+	}
+	return nil
+}
+
 var File_proto_manga_manga_proto protoreflect.FileDescriptor
 
 const file_proto_manga_manga_proto_rawDesc = "" +
 	"\n" +
 	"\x17proto/manga/manga.proto\x12\x05manga\"!\n" +
 	"\x0fGetMangaRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"\xc6\x01\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xfb\x01\n" +
 	"\rMangaResponse\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
 	"\x05title\x18\x02 \x01(\tR\x05title\x12\x16\n" +
@@ -559,7 +1007,10 @@ const file_proto_manga_manga_proto_rawDesc = "" +
 	"\x06genres\x18\x04 \x01(\tR\x06genres\x12\x16\n" +
 	"\x06status\x18\x05 \x01(\tR\x06status\x12%\n" +
 	"\x0etotal_chapters\x18\x06 \x01(\x05R\rtotalChapters\x12 \n" +
-	"\vdescription\x18\a \x01(\tR\vdescription\"i\n" +
+	"\vdescription\x18\a \x01(\tR\vdescription\x12\x14\n" +
+	"\x05score\x18\b \x01(\x01R\x05score\x12\x1d\n" +
+	"\n" +
+	"vote_count\x18\t \x01(\x05R\tvoteCount\"i\n" +
 	"\rSearchRequest\x12\x14\n" +
 	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
 	"\x05genre\x18\x02 \x01(\tR\x05genre\x12\x16\n" +
@@ -583,12 +1034,42 @@ const file_proto_manga_manga_proto_rawDesc = "" +
 	"\bmanga_id\x18\x02 \x01(\tR\amangaId\"V\n" +
 	"\x13GetProgressResponse\x12\x16\n" +
 	"\x06exists\x18\x01 \x01(\bR\x06exists\x12'\n" +
-	"\x0fcurrent_chapter\x18\x02 \x01(\x05R\x0ecurrentChapter2\x8d\x02\n" +
+	"\x0fcurrent_chapter\x18\x02 \x01(\x05R\x0ecurrentChapter\"*\n" +
+	"\x14GetCollectionRequest\x12\x12\n" +
+	"\x04slug\x18\x01 \x01(\tR\x04slug\"\x9f\x01\n" +
+	"\x12CollectionResponse\x12\x12\n" +
+	"\x04slug\x18\x01 \x01(\tR\x04slug\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12)\n" +
+	"\x05items\x18\x05 \x03(\v2\x13.manga.SearchResultR\x05items\"1\n" +
+	"\x16ListCollectionsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"|\n" +
+	"\x11CollectionSummary\x12\x12\n" +
+	"\x04slug\x18\x01 \x01(\tR\x04slug\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x1d\n" +
+	"\n" +
+	"item_count\x18\x04 \x01(\x05R\titemCount\"U\n" +
+	"\x17ListCollectionsResponse\x12:\n" +
+	"\vcollections\x18\x01 \x03(\v2\x18.manga.CollectionSummaryR\vcollections\"A\n" +
+	"\x10RecommendRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"i\n" +
+	"\x0eRecommendation\x12)\n" +
+	"\x05manga\x18\x01 \x01(\v2\x13.manga.SearchResultR\x05manga\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x01R\x05score\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"T\n" +
+	"\x11RecommendResponse\x12?\n" +
+	"\x0frecommendations\x18\x01 \x03(\v2\x15.manga.RecommendationR\x0frecommendations2\xe8\x03\n" +
 	"\fMangaService\x12:\n" +
 	"\vSearchManga\x12\x14.manga.SearchRequest\x1a\x15.manga.SearchResponse\x128\n" +
 	"\bGetManga\x12\x16.manga.GetMangaRequest\x1a\x14.manga.MangaResponse\x12A\n" +
 	"\x0eUpdateProgress\x12\x16.manga.ProgressRequest\x1a\x17.manga.ProgressResponse\x12D\n" +
-	"\vGetProgress\x12\x19.manga.GetProgressRequest\x1a\x1a.manga.GetProgressResponseB\x16Z\x14mangahub/proto/mangab\x06proto3"
+	"\vGetProgress\x12\x19.manga.GetProgressRequest\x1a\x1a.manga.GetProgressResponse\x12G\n" +
+	"\rGetCollection\x12\x1b.manga.GetCollectionRequest\x1a\x19.manga.CollectionResponse\x12P\n" +
+	"\x0fListCollections\x12\x1d.manga.ListCollectionsRequest\x1a\x1e.manga.ListCollectionsResponse\x12>\n" +
+	"\tRecommend\x12\x17.manga.RecommendRequest\x1a\x18.manga.RecommendResponseB\x16Z\x14mangahub/proto/mangab\x06proto3"
 
 var (
 	file_proto_manga_manga_proto_rawDescOnce sync.Once
@@ -602,33 +1083,51 @@ func file_proto_manga_manga_proto_rawDescGZIP() []byte {
 	return file_proto_manga_manga_proto_rawDescData
 }
 
-var file_proto_manga_manga_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_proto_manga_manga_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_proto_manga_manga_proto_goTypes = []any{
-	(*GetMangaRequest)(nil),     // 0: manga.GetMangaRequest
-	(*MangaResponse)(nil),       // 1: manga.MangaResponse
-	(*SearchRequest)(nil),       // 2: manga.SearchRequest
-	(*SearchResult)(nil),        // 3: manga.SearchResult
-	(*SearchResponse)(nil),      // 4: manga.SearchResponse
-	(*ProgressRequest)(nil),     // 5: manga.ProgressRequest
-	(*ProgressResponse)(nil),    // 6: manga.ProgressResponse
-	(*GetProgressRequest)(nil),  // 7: manga.GetProgressRequest
-	(*GetProgressResponse)(nil), // 8: manga.GetProgressResponse
+	(*GetMangaRequest)(nil),         // 0: manga.GetMangaRequest
+	(*MangaResponse)(nil),           // 1: manga.MangaResponse
+	(*SearchRequest)(nil),           // 2: manga.SearchRequest
+	(*SearchResult)(nil),            // 3: manga.SearchResult
+	(*SearchResponse)(nil),          // 4: manga.SearchResponse
+	(*ProgressRequest)(nil),         // 5: manga.ProgressRequest
+	(*ProgressResponse)(nil),        // 6: manga.ProgressResponse
+	(*GetProgressRequest)(nil),      // 7: manga.GetProgressRequest
+	(*GetProgressResponse)(nil),     // 8: manga.GetProgressResponse
+	(*GetCollectionRequest)(nil),    // 9: manga.GetCollectionRequest
+	(*CollectionResponse)(nil),      // 10: manga.CollectionResponse
+	(*ListCollectionsRequest)(nil),  // 11: manga.ListCollectionsRequest
+	(*CollectionSummary)(nil),       // 12: manga.CollectionSummary
+	(*ListCollectionsResponse)(nil), // 13: manga.ListCollectionsResponse
+	(*RecommendRequest)(nil),        // 14: manga.RecommendRequest
+	(*Recommendation)(nil),          // 15: manga.Recommendation
+	(*RecommendResponse)(nil),       // 16: manga.RecommendResponse
 }
 var file_proto_manga_manga_proto_depIdxs = []int32{
-	3, // 0: manga.SearchResponse.results:type_name -> manga.SearchResult
-	2, // 1: manga.MangaService.SearchManga:input_type -> manga.SearchRequest
-	0, // 2: manga.MangaService.GetManga:input_type -> manga.GetMangaRequest
-	5, // 3: manga.MangaService.UpdateProgress:input_type -> manga.ProgressRequest
-	7, // 4: manga.MangaService.GetProgress:input_type -> manga.GetProgressRequest
-	4, // 5: manga.MangaService.SearchManga:output_type -> manga.SearchResponse
-	1, // 6: manga.MangaService.GetManga:output_type -> manga.MangaResponse
-	6, // 7: manga.MangaService.UpdateProgress:output_type -> manga.ProgressResponse
-	8, // 8: manga.MangaService.GetProgress:output_type -> manga.GetProgressResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	3,  // 0: manga.SearchResponse.results:type_name -> manga.SearchResult
+	3,  // 1: manga.CollectionResponse.items:type_name -> manga.SearchResult
+	12, // 2: manga.ListCollectionsResponse.collections:type_name -> manga.CollectionSummary
+	3,  // 3: manga.Recommendation.manga:type_name -> manga.SearchResult
+	15, // 4: manga.RecommendResponse.recommendations:type_name -> manga.Recommendation
+	2,  // 5: manga.MangaService.SearchManga:input_type -> manga.SearchRequest
+	0,  // 6: manga.MangaService.GetManga:input_type -> manga.GetMangaRequest
+	5,  // 7: manga.MangaService.UpdateProgress:input_type -> manga.ProgressRequest
+	7,  // 8: manga.MangaService.GetProgress:input_type -> manga.GetProgressRequest
+	9,  // 9: manga.MangaService.GetCollection:input_type -> manga.GetCollectionRequest
+	11, // 10: manga.MangaService.ListCollections:input_type -> manga.ListCollectionsRequest
+	14, // 11: manga.MangaService.Recommend:input_type -> manga.RecommendRequest
+	4,  // 12: manga.MangaService.SearchManga:output_type -> manga.SearchResponse
+	1,  // 13: manga.MangaService.GetManga:output_type -> manga.MangaResponse
+	6,  // 14: manga.MangaService.UpdateProgress:output_type -> manga.ProgressResponse
+	8,  // 15: manga.MangaService.GetProgress:output_type -> manga.GetProgressResponse
+	10, // 16: manga.MangaService.GetCollection:output_type -> manga.CollectionResponse
+	13, // 17: manga.MangaService.ListCollections:output_type -> manga.ListCollectionsResponse
+	16, // 18: manga.MangaService.Recommend:output_type -> manga.RecommendResponse
+	12, // [12:19] is the sub-list for method output_type
+	5,  // [5:12] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_manga_manga_proto_init() }
@@ -642,7 +1141,7 @@ func file_proto_manga_manga_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_manga_manga_proto_rawDesc), len(file_proto_manga_manga_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   9,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},